@@ -3,7 +3,11 @@
 // Created: 2025-01-15
 package sensitive
 
-import "errors"
+import (
+	"errors"
+	"io"
+	"io/fs"
+)
 
 type Builder struct {
 	detector *Detector
@@ -24,6 +28,13 @@ func (b *Builder) AddWord(word string, level Level) *Builder {
 	return b
 }
 
+func (b *Builder) AddWordWithOptions(word string, level Level, opts WordOptions) *Builder {
+	if err := b.detector.AddWordWithOptions(word, level, opts); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
 func (b *Builder) AddWords(words map[string]Level) *Builder {
 	if err := b.detector.AddWords(words); err != nil {
 		b.errors = append(b.errors, err)
@@ -31,6 +42,34 @@ func (b *Builder) AddWords(words map[string]Level) *Builder {
 	return b
 }
 
+func (b *Builder) AddAllowWord(phrase string) *Builder {
+	if err := b.detector.AddAllowWord(phrase); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
+func (b *Builder) AddAllowWords(phrases []string) *Builder {
+	if err := b.detector.AddAllowWords(phrases); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
+func (b *Builder) RemoveWord(word string) *Builder {
+	if err := b.detector.RemoveWord(word); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
+func (b *Builder) RemoveWords(words []string) *Builder {
+	if err := b.detector.RemoveWords(words); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
 func (b *Builder) LoadDict(path string) *Builder {
 	if err := b.detector.LoadDict(path); err != nil {
 		b.errors = append(b.errors, err)
@@ -45,6 +84,20 @@ func (b *Builder) LoadDictWithLevel(path string, level Level) *Builder {
 	return b
 }
 
+func (b *Builder) LoadDictWithOptions(path string, level Level, opts WordOptions) *Builder {
+	if err := b.detector.LoadDictWithOptions(path, level, opts); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
+func (b *Builder) LoadAllowDict(path string) *Builder {
+	if err := b.detector.LoadAllowDict(path); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
 func (b *Builder) LoadDictFromURL(url string) *Builder {
 	if err := b.detector.LoadDictFromURL(url); err != nil {
 		b.errors = append(b.errors, err)
@@ -59,6 +112,13 @@ func (b *Builder) LoadDictFromURLWithLevel(url string, level Level) *Builder {
 	return b
 }
 
+func (b *Builder) LoadDictFromURLWithOptions(url string, level Level, opts WordOptions) *Builder {
+	if err := b.detector.LoadDictFromURLWithOptions(url, level, opts); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
 func (b *Builder) LoadDictFromURLs(urls []string) *Builder {
 	for _, url := range urls {
 		if err := b.detector.LoadDictFromURL(url); err != nil {
@@ -68,6 +128,13 @@ func (b *Builder) LoadDictFromURLs(urls []string) *Builder {
 	return b
 }
 
+func (b *Builder) Load(plan LoadPlan) *Builder {
+	if _, err := b.detector.Load(plan); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
 func (b *Builder) LoadVariantMap(path string) *Builder {
 	if err := b.detector.LoadVariantMap(path); err != nil {
 		b.errors = append(b.errors, err)
@@ -75,6 +142,30 @@ func (b *Builder) LoadVariantMap(path string) *Builder {
 	return b
 }
 
+func (b *Builder) LoadVariantMapFromReader(r io.Reader) *Builder {
+	if err := b.detector.LoadVariantMapFromReader(r); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
+func (b *Builder) LoadVariantMapFS(fsys fs.FS, name string) *Builder {
+	if err := b.detector.LoadVariantMapFS(fsys, name); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
+func (b *Builder) AddVariants(variants map[rune]rune) *Builder {
+	b.detector.AddVariants(variants)
+	return b
+}
+
+func (b *Builder) AddVariantRules(rules map[string]string) *Builder {
+	b.detector.AddVariantRules(rules)
+	return b
+}
+
 func (b *Builder) LoadEmbeddedDict(name string, level Level) *Builder {
 	if err := LoadEmbeddedDict(b.detector, name, level); err != nil {
 		b.errors = append(b.errors, err)
@@ -82,6 +173,13 @@ func (b *Builder) LoadEmbeddedDict(name string, level Level) *Builder {
 	return b
 }
 
+func (b *Builder) LoadEmbeddedDictWithOptions(name string, level Level, opts WordOptions) *Builder {
+	if err := LoadEmbeddedDictWithOptions(b.detector, name, level, opts); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
 func (b *Builder) LoadAllEmbedded() *Builder {
 	if err := LoadAllEmbedded(b.detector); err != nil {
 		b.errors = append(b.errors, err)
@@ -89,11 +187,57 @@ func (b *Builder) LoadAllEmbedded() *Builder {
 	return b
 }
 
+func (b *Builder) LoadEmbeddedAllowDict(name string) *Builder {
+	if err := LoadEmbeddedAllowDict(b.detector, name); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
+func (b *Builder) LoadEmbeddedVariantMap(name string) *Builder {
+	if err := LoadEmbeddedVariantMap(b.detector, name); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
+func (b *Builder) LoadAllEmbeddedVariants() *Builder {
+	if err := LoadAllEmbeddedVariants(b.detector); err != nil {
+		b.errors = append(b.errors, err)
+	}
+	return b
+}
+
 func (b *Builder) WithFilterStrategy(strategy FilterStrategy) *Builder {
 	b.detector.opts.FilterStrategy = strategy
 	return b
 }
 
+func (b *Builder) WithCategoryStrategy(category string, strategy FilterStrategy) *Builder {
+	b.detector.opts.CategoryStrategies = categoryStrategies(b.detector.opts.CategoryStrategies, category, strategy)
+	return b
+}
+
+func (b *Builder) WithMinLevel(level Level) *Builder {
+	b.detector.opts.MinLevel = level
+	return b
+}
+
+func (b *Builder) WithConflictPolicy(policy ConflictPolicy) *Builder {
+	b.detector.opts.ConflictPolicy = policy
+	return b
+}
+
+func (b *Builder) WithMatchMode(mode MatchMode) *Builder {
+	b.detector.opts.MatchMode = mode
+	return b
+}
+
+func (b *Builder) WithMaxInputSize(size int) *Builder {
+	b.detector.opts.MaxInputSize = size
+	return b
+}
+
 func (b *Builder) WithReplaceChar(char rune) *Builder {
 	b.detector.opts.ReplaceChar = char
 	return b
@@ -101,16 +245,73 @@ func (b *Builder) WithReplaceChar(char rune) *Builder {
 
 func (b *Builder) WithSkipWhitespace(skip bool) *Builder {
 	b.detector.opts.SkipWhitespace = skip
+	b.detector.reconfigure()
+	return b
+}
+
+func (b *Builder) WithSkipFunc(fn func(rune) bool) *Builder {
+	b.detector.opts.SkipFunc = fn
+	b.detector.reconfigure()
 	return b
 }
 
 func (b *Builder) WithVariant(enable bool) *Builder {
 	b.detector.opts.EnableVariant = enable
+	b.detector.reconfigure()
 	return b
 }
 
 func (b *Builder) WithCaseSensitive(sensitive bool) *Builder {
 	b.detector.opts.CaseSensitive = sensitive
+	b.detector.reconfigure()
+	return b
+}
+
+func (b *Builder) WithConfusableFolding(enable bool) *Builder {
+	b.detector.opts.ConfusableFolding = enable
+	b.detector.reconfigure()
+	return b
+}
+
+func (b *Builder) WithNFKC(enable bool) *Builder {
+	b.detector.opts.NFKC = enable
+	b.detector.reconfigure()
+	return b
+}
+
+func (b *Builder) WithPinyin(enable bool) *Builder {
+	b.detector.opts.Pinyin = enable
+	b.detector.reconfigure()
+	return b
+}
+
+func (b *Builder) WithPinyinInitials(enable bool) *Builder {
+	b.detector.opts.PinyinInitials = enable
+	b.detector.reconfigure()
+	return b
+}
+
+func (b *Builder) WithPhonetic(enable bool) *Builder {
+	b.detector.opts.Phonetic = enable
+	b.detector.reconfigure()
+	return b
+}
+
+func (b *Builder) WithSplitCharacters(enable bool) *Builder {
+	b.detector.opts.SplitCharacters = enable
+	b.detector.reconfigure()
+	return b
+}
+
+func (b *Builder) WithLeetFolding(table map[rune]rune) *Builder {
+	b.detector.opts.LeetTable = leetTable(table)
+	b.detector.reconfigure()
+	return b
+}
+
+func (b *Builder) WithLeetASCIIOnly(only bool) *Builder {
+	b.detector.opts.LeetASCIIOnly = only
+	b.detector.reconfigure()
 	return b
 }
 
@@ -5,27 +5,68 @@ package sensitive
 
 import (
 	"bufio"
+	"cmp"
+	"context"
 	"errors"
+	"io"
+	"io/fs"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/Done-0/sensitive/internal/normalizer"
-	"github.com/Done-0/sensitive/internal/pool"
 	"github.com/Done-0/sensitive/internal/trie"
 )
 
+const (
+	maxPooled    = 65536 // Capacity, in elements, of the largest buffer kept for reuse
+	maxConflicts = 1024  // Conflicts kept for Conflicts, the oldest are dropped first
+)
+
 type Detector struct {
-	tree       *trie.Tree
+	current    atomic.Pointer[snapshot]
+	source     *trie.Tree
+	allow      *trie.Tree             // Allowlisted phrases, see AddAllowWord
+	wordOpts   map[string]WordOptions // Words added with non-default options
+	sharedOpts bool                   // wordOpts is referenced by a snapshot and copied before it changes
+	origins    map[string]string      // Dictionary each word was loaded from, see WordSource
+	extra      map[string][]dictEntry // Further additions of words kept by ConflictKeepAll
+	conflicts  []Conflict             // Latest conflicts in the order they were resolved
+	phonetic   *trie.Tree             // Words keyed by pronunciation, see WithPhonetic
+	pinyin     map[rune]string        // Normalized pinyin of every Hanzi, nil unless phonetic matching is on
+	components map[[2]rune]rune       // Normalized component pairs and the Hanzi they form, see WithSplitCharacters
 	mu         sync.RWMutex
 	normalizer *normalizer.Normalizer
 	opts       *Options
-	built      atomic.Bool
+	dirty      bool
 	count      int
+	allowed    int
 	runePool   sync.Pool
+	textPool   sync.Pool
+}
+
+// snapshot is a compiled automaton together with the normalizer its keys were
+// folded with, published as a unit so searches never mix the two
+type snapshot struct {
+	tree       *trie.Tree
+	allow      *trie.Tree
+	wordOpts   map[string]WordOptions
+	bounded    bool // Some word only matches whole words
+	aliased    bool // Words have pinyin aliases, which only match whole Latin words
+	expanded   bool // The normalizer spells some characters with several runes
+	extra      map[string][]dictEntry
+	phonetic   *trie.Tree
+	pinyin     map[rune]string
+	components map[[2]rune]rune
+	normalizer *normalizer.Normalizer
 }
 
 func New(opts ...Option) *Detector {
@@ -35,13 +76,16 @@ func New(opts ...Option) *Detector {
 		SkipWhitespace: true,
 		EnableVariant:  false,
 		CaseSensitive:  false,
+		LeetASCIIOnly:  true,
 	}
 	for _, opt := range opts {
 		opt(o)
 	}
 
-	return &Detector{
-		tree:       trie.New(),
+	d := &Detector{
+		source:     trie.New(),
+		allow:      trie.New(),
+		phonetic:   trie.New(),
 		normalizer: normalizer.New(o.EnableVariant, o.CaseSensitive),
 		opts:       o,
 		runePool: sync.Pool{
@@ -50,31 +94,281 @@ func New(opts ...Option) *Detector {
 				return &buf
 			},
 		},
+		textPool: sync.Pool{
+			New: func() any { return &normalizer.Text{} },
+		},
 	}
+	d.configureNormalizer()
+	return d
 }
 
 func (d *Detector) AddWord(word string, level Level) error {
-	if word == "" {
+	return d.AddWordWithOptions(word, level, WordOptions{})
+}
+
+// AddWordWithOptions adds word like AddWord with the attributes in opts. If
+// the word is already present with another level or options, the detector's
+// ConflictPolicy decides which addition is kept
+func (d *Detector) AddWordWithOptions(word string, level Level, opts WordOptions) error {
+	return d.add(dictEntry{word: word, level: level, opts: opts}, nil)
+}
+
+// add adds e, a different word or addition already under the same key is
+// kept or replaced by the conflict policy. Conflicts are also appended to log
+// unless it is nil
+func (d *Detector) add(e dictEntry, log *[]Conflict) error {
+	if e.word == "" {
 		return errors.New("empty word")
 	}
-	if !level.IsValid() {
+	if !e.level.IsValid() {
 		return errors.New("invalid level")
 	}
 
 	d.mu.Lock()
-	normalized := d.normalizer.Normalize(word)
+	defer d.mu.Unlock()
+
+	normalized := d.normalizer.Normalize(e.word)
 	if normalized == "" {
-		d.mu.Unlock()
 		return errors.New("normalized word is empty")
 	}
+	d.place(d.keyOf(normalized), e, log)
+	return nil
+}
 
-	d.tree.Insert(normalized, int(level))
-	d.count++
-	d.built.Store(false)
-	d.mu.Unlock()
+// place stores e under key, it reports false if the addition already under key
+// is kept instead
+func (d *Detector) place(key string, e dictEntry, log *[]Conflict) bool {
+	if current, ok := d.entryAt(key); ok {
+		if current.same(e) || slices.ContainsFunc(d.extra[current.word], e.same) {
+			return false
+		}
+		d.dirty = true
+		if !d.resolve(current, e, log) {
+			return false
+		}
+	}
+
+	d.insertKey(key, e.word, int(e.level))
+	d.setWordOptions(e.word, e.opts)
+	d.setOrigin(e.word, e.source)
+	d.dirty = true
+	return true
+}
+
+// entryAt returns the addition in effect under key
+func (d *Detector) entryAt(key string) (dictEntry, bool) {
+	word, level, ok := d.source.Lookup(key)
+	if !ok {
+		return dictEntry{}, false
+	}
+	return dictEntry{word: word, level: Level(level), opts: d.wordOpts[word], source: d.origins[word]}, true
+}
+
+// resolve records the conflict between the addition in effect and e, it
+// reports whether e replaces current
+func (d *Detector) resolve(current, e dictEntry, log *[]Conflict) bool {
+	var replace bool
+	switch d.opts.ConflictPolicy {
+	case ConflictFirstWins:
+	case ConflictMaxLevel, ConflictKeepAll:
+		replace = e.level > current.level
+	default:
+		replace = true
+	}
+
+	winner, loser := current, e
+	if replace {
+		winner, loser = e, current
+	}
+	conflict := Conflict{Winner: winner.wordSource(), Loser: loser.wordSource()}
+	if len(d.conflicts) == maxConflicts {
+		d.conflicts = d.conflicts[1:]
+	}
+	d.conflicts = append(d.conflicts, conflict)
+	if log != nil {
+		*log = append(*log, conflict)
+	}
+
+	if d.opts.ConflictPolicy == ConflictKeepAll {
+		kept := append(slices.Clip(d.extra[current.word]), loser)
+		if e.word != current.word {
+			// A word folded again by rekey brings its own kept additions
+			kept = append(kept, d.extra[e.word]...)
+			delete(d.extra, e.word)
+		}
+		delete(d.extra, current.word)
+		if d.extra == nil {
+			d.extra = make(map[string][]dictEntry)
+		}
+		d.extra[winner.word] = kept
+	}
+	if replace && current.word != e.word {
+		d.deleteWordOptions(current.word)
+		delete(d.origins, current.word)
+	}
+	return replace
+}
+
+func (d *Detector) setOrigin(word, source string) {
+	if source == "" {
+		delete(d.origins, word)
+		return
+	}
+	if d.origins == nil {
+		d.origins = make(map[string]string)
+	}
+	d.origins[word] = source
+}
+
+// Conflicts lists the words added again with a different level or options, in
+// the order the conflicts were resolved, see WithConflictPolicy. Only the
+// latest 1024 conflicts are kept, Load reports every conflict of its plan
+func (d *Detector) Conflicts() []Conflict {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return slices.Clone(d.conflicts)
+}
+
+func (d *Detector) setWordOptions(word string, opts WordOptions) {
+	if opts == (WordOptions{}) {
+		d.deleteWordOptions(word)
+		return
+	}
+	if d.wordOpts == nil {
+		d.wordOpts = make(map[string]WordOptions)
+	}
+	if current, ok := d.wordOpts[word]; ok && current == opts {
+		return
+	}
+	d.ownWordOptions()
+	d.wordOpts[word] = opts
+}
+
+func (d *Detector) deleteWordOptions(word string) {
+	if _, ok := d.wordOpts[word]; ok {
+		d.ownWordOptions()
+		delete(d.wordOpts, word)
+	}
+}
+
+// ownWordOptions copies wordOpts if a published snapshot still reads it
+func (d *Detector) ownWordOptions() {
+	if d.sharedOpts {
+		d.wordOpts = maps.Clone(d.wordOpts)
+		d.sharedOpts = false
+	}
+}
+
+// insertKey adds word under key, its aliases and its pronunciation
+func (d *Detector) insertKey(key, word string, level int) {
+	if d.source.Insert(key, word, level) {
+		d.count++
+	}
+	for _, alias := range d.aliases(key) {
+		d.source.InsertAlias(alias, word, level)
+	}
+	if spelled, ok := d.phoneticKey(key); ok {
+		d.phonetic.InsertAlias(spelled, word, level)
+	}
+}
+
+// phoneticKey spells every Hanzi of key by its pinyin, so a Hanzi, its pinyin
+// and its homophones all lead to the same key. Words with fewer than two
+// Hanzi get none
+func (d *Detector) phoneticKey(key string) (string, bool) {
+	if d.pinyin == nil {
+		return "", false
+	}
+	var spelled strings.Builder
+	hanzi := 0
+	for _, r := range key {
+		if syllable, ok := d.pinyin[r]; ok {
+			spelled.WriteString(syllable)
+			hanzi++
+		} else {
+			spelled.WriteRune(r)
+		}
+	}
+	return spelled.String(), hanzi >= 2
+}
+
+// aliases returns the extra keys word is indexed under, the full pinyin of
+// words with at least two Hanzi and, with WithPinyinInitials, the initials of
+// words of three Hanzi or more. Shorter forms would match ordinary text far
+// too often
+func (d *Detector) aliases(key string) []string {
+	if !d.opts.Pinyin {
+		return nil
+	}
+
+	table := embeddedPinyin()
+	var full, initials strings.Builder
+	hanzi, other := 0, 0
+	for _, r := range key {
+		syllable, ok := table[r]
+		if !ok {
+			full.WriteRune(r)
+			other++
+			continue
+		}
+		full.WriteString(syllable)
+		initials.WriteByte(syllable[0])
+		hanzi++
+	}
+	if hanzi < 2 {
+		return nil
+	}
+
+	aliases := make([]string, 0, 2)
+	for i, alias := range []string{full.String(), initials.String()} {
+		if i == 1 && (!d.opts.PinyinInitials || hanzi < 3 || other > 0) {
+			break
+		}
+		if normalized := d.normalizer.Normalize(alias); normalized != "" {
+			aliases = append(aliases, d.keyOf(normalized))
+		}
+	}
+	return aliases
+}
+
+// AddAllowWord allowlists phrase, a match that lies entirely within an
+// occurrence of phrase is dropped, such as "网络" inside "网络安全". Like
+// AddWord, the change takes effect on the next Build
+func (d *Detector) AddAllowWord(phrase string) error {
+	if phrase == "" {
+		return errors.New("empty word")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.insertAllow(phrase) {
+		return errors.New("normalized word is empty")
+	}
+	d.dirty = true
 	return nil
 }
 
+func (d *Detector) AddAllowWords(phrases []string) error {
+	for _, phrase := range phrases {
+		if err := d.AddAllowWord(phrase); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *Detector) insertAllow(phrase string) bool {
+	normalized := d.normalizer.Normalize(phrase)
+	if normalized == "" {
+		return false
+	}
+	if d.allow.Insert(d.keyOf(normalized), phrase, 0) {
+		d.allowed++
+	}
+	return true
+}
+
 func (d *Detector) AddWords(words map[string]Level) error {
 	for word, level := range words {
 		if err := d.AddWord(word, level); err != nil {
@@ -84,139 +378,688 @@ func (d *Detector) AddWords(words map[string]Level) error {
 	return nil
 }
 
+// RemoveWord deletes word from the dictionary, removing a word that was never
+// added is a no-op. Like AddWord, the change takes effect on the next Build
+func (d *Detector) RemoveWord(word string) error {
+	if word == "" {
+		return errors.New("empty word")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	normalized := d.normalizer.Normalize(word)
+	if normalized == "" {
+		return errors.New("normalized word is empty")
+	}
+
+	// Everything else hangs off the word as it was added, which may be
+	// spelled differently from the one given, such as "國家" for "国家"
+	key := d.keyOf(normalized)
+	stored, _, ok := d.source.Lookup(key)
+	if !ok {
+		return nil
+	}
+	d.source.Remove(key)
+	d.count--
+	d.dirty = true
+	d.deleteWordOptions(stored)
+	delete(d.origins, stored)
+	delete(d.extra, stored)
+	for _, alias := range d.aliases(key) {
+		d.source.RemoveAlias(alias, stored)
+	}
+	if spelled, ok := d.phoneticKey(key); ok {
+		d.phonetic.RemoveAlias(spelled, stored)
+	}
+	return nil
+}
+
+func (d *Detector) RemoveWords(words []string) error {
+	for _, word := range words {
+		if err := d.RemoveWord(word); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Build compiles the current words into a new automaton and publishes it
+// atomically, searches keep using the previous automaton until it returns
 func (d *Detector) Build() error {
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	d.tree.Build()
-	d.built.Store(true)
+	if d.current.Load() != nil && !d.dirty {
+		return nil
+	}
+
+	d.current.Store(d.compile())
+	d.dirty = false
+	return nil
+}
+
+func (d *Detector) compile() *snapshot {
+	snap := &snapshot{tree: d.source.Compile(), aliased: d.opts.Pinyin, components: d.components, normalizer: d.normalizer.Clone()}
+	snap.tree.WholeWordNoise()
+	snap.expanded = snap.normalizer.Expands()
+	if d.allowed > 0 {
+		snap.allow = d.allow.Compile()
+		snap.allow.WholeWordNoise()
+	}
+	if len(d.wordOpts) > 0 {
+		snap.wordOpts = d.wordOpts
+		d.sharedOpts = true
+		for _, opts := range d.wordOpts {
+			if opts.Boundary == BoundaryWord {
+				snap.bounded = true
+				break
+			}
+		}
+	}
+	if len(d.extra) > 0 {
+		snap.extra = maps.Clone(d.extra)
+	}
+	if d.pinyin != nil {
+		snap.phonetic = d.phonetic.Compile()
+		snap.pinyin = d.pinyin
+	}
+	return snap
+}
+
+// Reload replaces the whole dictionary without blocking searches. load fills a
+// fresh detector with this detector's options, variant map and allowlist, which
+// is compiled off to the side and swapped in only if load succeeds
+func (d *Detector) Reload(load func(*Detector) error) error {
+	d.mu.RLock()
+	opts := *d.opts
+	norm := d.normalizer.Clone()
+	pinyin := d.pinyin
+	components := d.components
+	var allowed []string
+	d.allow.Walk(func(phrase string, _ int) {
+		allowed = append(allowed, phrase)
+	})
+	d.mu.RUnlock()
+
+	next := New()
+	next.opts = &opts
+	next.normalizer = norm
+	next.pinyin = pinyin
+	next.components = components
+	for _, phrase := range allowed {
+		next.insertAllow(phrase)
+	}
+	if err := load(next); err != nil {
+		return err
+	}
+	snap := next.compile()
+
+	d.mu.Lock()
+	d.source = next.source
+	d.allow = next.allow
+	d.allowed = next.allowed
+	d.wordOpts = next.wordOpts
+	d.sharedOpts = next.sharedOpts
+	d.origins = next.origins
+	d.extra = next.extra
+	d.conflicts = next.conflicts
+	d.phonetic = next.phonetic
+	d.normalizer = next.normalizer
+	d.count = next.count
+	d.dirty = false
+	d.current.Store(snap)
+	d.mu.Unlock()
 	return nil
 }
 
+// putText returns t to the pool unless a long text grew it, so one huge input
+// does not keep its buffers alive
+func (d *Detector) putText(t *normalizer.Text) {
+	if cap(t.Runes) <= maxPooled && cap(t.Offsets) <= maxPooled {
+		d.textPool.Put(t)
+	}
+}
+
+// snapshot returns the published automaton, building it on first use so that
+// searches never run against an unbuilt tree
+func (d *Detector) snapshot() *snapshot {
+	if snap := d.current.Load(); snap != nil {
+		return snap
+	}
+	d.Build()
+	return d.current.Load()
+}
+
+// rekey folds every word again after the normalizer or the noise rules changed.
+// Words that now fold to the same key are resolved by the conflict policy, in
+// the order of their previous keys
+func (d *Detector) rekey() {
+	old, allow := d.source, d.allow
+	d.source, d.phonetic, d.count = trie.New(), trie.New(), 0
+	d.allow, d.allowed = trie.New(), 0
+	old.Walk(func(word string, level int) {
+		normalized := d.normalizer.Normalize(word)
+		e := dictEntry{word: word, level: Level(level), opts: d.wordOpts[word], source: d.origins[word]}
+		if normalized == "" || !d.place(d.keyOf(normalized), e, nil) {
+			d.deleteWordOptions(word)
+			delete(d.origins, word)
+			delete(d.extra, word)
+		}
+	})
+	allow.Walk(func(phrase string, _ int) {
+		d.insertAllow(phrase)
+	})
+	d.dirty = true
+}
+
+// reconfigure applies options changed after New, such as by the Builder
+func (d *Detector) reconfigure() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.configureNormalizer()
+	d.rekey()
+}
+
+// configureNormalizer passes the normalization options to d.normalizer
+func (d *Detector) configureNormalizer() {
+	d.normalizer.Configure(d.opts.EnableVariant, d.opts.CaseSensitive)
+	d.normalizer.SetNFKC(d.opts.NFKC)
+	d.normalizer.SetConfusables(d.confusables())
+	d.normalizer.SetLeet(d.opts.LeetTable, d.opts.LeetASCIIOnly)
+	d.loadDefaultVariants()
+	d.pinyin = d.phoneticTable()
+	d.components = d.componentTable()
+}
+
+// phoneticTable normalizes the pinyin of every Hanzi like input text, so the
+// spelled out Hanzi and pinyin typed by users fold the same way
+func (d *Detector) phoneticTable() map[rune]string {
+	if !d.opts.Phonetic {
+		return nil
+	}
+	table := embeddedPinyin()
+	syllables := make(map[string]string, 512)
+	pinyin := make(map[rune]string, len(table))
+	for r, syllable := range table {
+		normalized, ok := syllables[syllable]
+		if !ok {
+			normalized = d.normalizer.Normalize(syllable)
+			syllables[syllable] = normalized
+		}
+		pinyin[r] = normalized
+	}
+	return pinyin
+}
+
+// componentTable normalizes the component table like input text, pairs that
+// do not fold to two characters and one character are left out
+func (d *Detector) componentTable() map[[2]rune]rune {
+	if !d.opts.SplitCharacters {
+		return nil
+	}
+	table := embeddedComponents()
+	components := make(map[[2]rune]rune, len(table))
+	for from, to := range table {
+		pair, char := []rune(d.normalizer.Normalize(from)), []rune(d.normalizer.Normalize(to))
+		if len(pair) == 2 && len(char) == 1 {
+			components[[2]rune{pair[0], pair[1]}] = char[0]
+		}
+	}
+	return components
+}
+
+func (d *Detector) confusables() map[rune]string {
+	if !d.opts.ConfusableFolding {
+		return nil
+	}
+	return embeddedConfusables()
+}
+
+// loadDefaultVariants makes variant detection work out of the box with the
+// embedded tables, explicitly loaded maps are merged on top of them
+func (d *Detector) loadDefaultVariants() {
+	if d.opts.EnableVariant && !d.normalizer.IsVariantLoaded() {
+		d.normalizer.AddVariants(embeddedVariants())
+	}
+}
+
 func (d *Detector) Detect(text string) *Result {
+	return d.DetectWithOptions(text)
+}
+
+// DetectWithOptions detects like Detect, and only reports and filters the
+// matches that opts select, such as Categories(CategoryPolitics) or
+// MinLevel(LevelMedium)
+func (d *Detector) DetectWithOptions(text string, opts ...DetectOption) *Result {
+	return d.detect(text, opts, nil)
+}
+
+// DetectContext detects like DetectWithOptions while checking ctx every few
+// thousand characters, it returns ctx's error once ctx is done. Text longer
+// than WithMaxInputSize is refused with an *InputTooLargeError before any
+// buffer is allocated for it
+func (d *Detector) DetectContext(ctx context.Context, text string, opts ...DetectOption) (*Result, error) {
+	if limit := d.opts.MaxInputSize; limit > 0 && len(text) > limit {
+		return nil, &InputTooLargeError{Size: len(text), Limit: limit}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var stop func() bool
+	if ctx.Done() != nil {
+		stop = func() bool { return ctx.Err() != nil }
+	}
+	result := d.detect(text, opts, stop)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// detect runs a detection, stop ends it early when it returns true and the
+// result is then incomplete
+func (d *Detector) detect(text string, opts []DetectOption, stop func() bool) *Result {
 	result := &Result{FilteredText: text}
 	if text == "" {
 		return result
 	}
 
-	bufPtr := d.runePool.Get().(*[]rune)
-	if cap(*bufPtr) < len(text) {
-		*bufPtr = make([]rune, 0, len(text))
+	o := detectOptions{minLevel: d.opts.MinLevel}
+	for _, opt := range opts {
+		opt(&o)
 	}
-	runes := d.normalizer.ToRunes(text, *bufPtr)
 
-	d.mu.RLock()
-	if !d.built.Load() {
-		d.mu.RUnlock()
-		d.runePool.Put(bufPtr)
-		return result
-	}
-	matches := d.tree.SearchDAT(runes)
-	d.mu.RUnlock()
+	snap := d.snapshot()
+	normalized := d.textPool.Get().(*normalizer.Text)
+	defer d.putText(normalized)
+	snap.normalizer.ToText(text, normalized)
 
-	if len(matches) > 0 {
+	result.Matches = d.matches(snap, text, normalized, stop)
+	if o.categories != nil {
+		result.Matches = slices.DeleteFunc(result.Matches, func(m Match) bool { return !o.keep(m) })
+	}
+	filtered := result.Matches
+	if o.minLevel > LevelLow {
+		filtered = slices.DeleteFunc(slices.Clone(filtered), func(m Match) bool { return m.Level < o.minLevel })
+	}
+	if len(filtered) > 0 {
 		result.HasSensitive = true
-		result.Matches = make([]Match, len(matches))
-		for i, m := range matches {
-			result.Matches[i] = Match{
-				Word:  m.Word,
-				Start: m.Start,
-				End:   m.End,
-				Level: Level(m.Level),
-			}
+		result.FilteredText = d.filter(snap, text, filtered)
+	}
+
+	return result
+}
+
+// matches returns every match in normalized ordered by end position, less
+// the ones covered by an allowlisted phrase and those the match mode leaves
+// out. Overlaps are resolved during the walk unless later passes still add or
+// drop matches. stop is checked during the main walk and before every further
+// pass
+func (d *Detector) matches(snap *snapshot, text string, normalized *normalizer.Text, stop func() bool) []Match {
+	overlap := trie.Overlap(d.opts.MatchMode)
+	walk := overlap
+	if snap.rewritten() {
+		walk = trie.OverlapAll
+	}
+
+	var matches []Match
+	for _, m := range snap.tree.Search(normalized.Runes, d.skipFunc(), walk, stop) {
+		if snap.expanded && !onBoundaries(normalized.Starts, m) {
+			continue
 		}
+		if match := newMatch(text, normalized, m); !m.Alias || !splitsWord(text, match.ByteStart, match.ByteEnd) {
+			matches = append(matches, match)
+		}
+	}
+	if stop != nil && stop() {
+		return matches
+	}
+	if snap.phonetic != nil {
+		matches = d.mergeMatches(matches, d.phoneticMatches(snap, text, normalized, LevelLow, false))
+	}
+	if snap.components != nil && (stop == nil || !stop()) {
+		matches = d.mergeMatches(matches, d.splitMatches(snap, text, normalized, LevelLow, false))
+	}
+	if snap.bounded {
+		matches = slices.DeleteFunc(matches, func(m Match) bool {
+			return snap.wordOpts[m.Word].Boundary == BoundaryWord && splitsWord(text, m.ByteStart, m.ByteEnd)
+		})
+	}
+	if snap.wordOpts != nil {
+		for i := range matches {
+			matches[i].Category = snap.wordOpts[matches[i].Word].Category
+		}
+	}
+	if snap.extra != nil {
+		matches = withKept(snap, matches)
+	}
+	if snap.allow != nil && len(matches) > 0 && (stop == nil || !stop()) {
+		matches = d.dropAllowed(snap, normalized, matches)
+	}
+	if walk != overlap {
+		matches = trie.Resolve(matches, overlap, matchSpan)
+	}
+	return matches
+}
 
-		textRunes := runes
-		n := len(textRunes)
+func matchSpan(m Match) (int, int, int) {
+	return m.Start, m.End, int(m.Level)
+}
 
-		mask := pool.GetBools(n)
-		defer pool.PutBools(mask)
+// withKept follows every match by one for each further addition of its word
+// kept by ConflictKeepAll, with that addition's level and category
+func withKept(snap *snapshot, matches []Match) []Match {
+	all := make([]Match, 0, len(matches))
+	for _, m := range matches {
+		all = append(all, m)
+		for _, e := range snap.extra[m.Word] {
+			m.Word, m.Level, m.Category = e.word, e.level, e.opts.Category
+			all = append(all, m)
+		}
+	}
+	return all
+}
 
-		for _, m := range result.Matches {
-			for i := m.Start; i < m.End && i < n; i++ {
-				(*mask)[i] = true
-			}
+// filtered reports whether matches have to be checked against the text before
+// they are reported
+func (s *snapshot) filtered() bool {
+	return s.allow != nil || s.bounded || s.aliased || s.expanded
+}
+
+// rewritten reports whether matches are added or dropped after the walk
+func (s *snapshot) rewritten() bool {
+	return s.filtered() || s.phonetic != nil || s.components != nil || s.extra != nil
+}
+
+// dropAllowed removes the matches lying entirely within an allowlisted phrase
+// found in the same text
+func (d *Detector) dropAllowed(snap *snapshot, normalized *normalizer.Text, matches []Match) []Match {
+	allowed := snap.allow.SearchDAT(normalized.Runes, d.skipFunc())
+	if len(allowed) == 0 {
+		return matches
+	}
+	spans := make([][2]int, 0, len(allowed))
+	for _, a := range allowed {
+		start, end, _, _ := normalized.Span(a.Start, a.End)
+		spans = append(spans, [2]int{start, end})
+	}
+	return slices.DeleteFunc(matches, func(m Match) bool {
+		return slices.ContainsFunc(spans, func(s [2]int) bool {
+			return s[0] <= m.Start && m.End <= s[1]
+		})
+	})
+}
+
+// phoneticMatches searches the pronunciation of normalized for words of level
+// min or above. A match has to start and end on character boundaries, must not
+// cut through a Latin word and has to cover at least one Hanzi, so pinyin
+// syllables hidden in ordinary words are not reported
+func (d *Detector) phoneticMatches(snap *snapshot, text string, normalized *normalizer.Text, min Level, first bool) []Match {
+	spelled := d.textPool.Get().(*normalizer.Text)
+	defer d.putText(spelled)
+	normalized.Transliterate(snap.pinyin, spelled)
+
+	var matches []Match
+	for _, m := range snap.phonetic.SearchDAT(spelled.Runes, d.skipFunc()) {
+		if Level(m.Level) < min || !onBoundaries(spelled.Starts, m) {
+			continue
+		}
+		match := newMatch(text, spelled, m)
+		if splitsWord(text, match.ByteStart, match.ByteEnd) || !strings.ContainsFunc(match.Matched, isHanzi) {
+			continue
+		}
+		matches = append(matches, match)
+		if first {
+			break
 		}
+	}
+	return matches
+}
 
-		filtered := pool.GetRunes(n)
-		defer pool.PutRunes(filtered)
+// splitMatches searches normalized with every component pair joined into the
+// Hanzi it forms for words of level min or above, a joined Hanzi spans both
+// components
+func (d *Detector) splitMatches(snap *snapshot, text string, normalized *normalizer.Text, min Level, first bool) []Match {
+	composed := d.textPool.Get().(*normalizer.Text)
+	defer d.putText(composed)
+	if !normalized.Compose(snap.components, composed) {
+		return nil
+	}
 
-		replaceChar := d.opts.ReplaceChar
-		if d.opts.FilterStrategy == StrategyMask {
-			replaceChar = '*'
+	if first {
+		if m := snap.tree.FindFirst(composed.Runes, d.skipFunc(), int(min)); m != nil {
+			return []Match{newMatch(text, composed, *m)}
+		}
+		return nil
+	}
+	var matches []Match
+	for _, m := range snap.tree.SearchDAT(composed.Runes, d.skipFunc()) {
+		if Level(m.Level) < min || snap.expanded && !onBoundaries(composed.Starts, m) {
+			continue
+		}
+		if match := newMatch(text, composed, m); !m.Alias || !splitsWord(text, match.ByteStart, match.ByteEnd) {
+			matches = append(matches, match)
 		}
+	}
+	return matches
+}
 
-		for i, r := range textRunes {
-			if (*mask)[i] {
-				if d.opts.FilterStrategy != StrategyRemove {
-					*filtered = append(*filtered, replaceChar)
-				}
-			} else {
-				*filtered = append(*filtered, r)
-			}
+// onBoundaries reports whether m starts on the first rune spelled for a
+// character and ends on the last, so it never takes part of a character
+// spelled with several runes, such as the "r" of the skeleton "rn" of "m"
+func onBoundaries(starts []int, m trie.Match) bool {
+	return boundary(starts, m.Start) && boundary(starts, m.End)
+}
+
+// boundary reports whether i is the first rune spelled for its character
+func boundary(starts []int, i int) bool {
+	return i == 0 || i == len(starts) || starts[i] != starts[i-1]
+}
+
+// splitsWord reports whether the bytes [start, end) of text begin or end
+// inside a run of Latin letters and digits
+func splitsWord(text string, start, end int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:start])
+	first, _ := utf8.DecodeRuneInString(text[start:])
+	last, _ := utf8.DecodeLastRuneInString(text[:end])
+	after, _ := utf8.DecodeRuneInString(text[end:])
+	return crossesWord(before, first, last, after)
+}
+
+// crossesWord reports whether a match running from first to last, between
+// before and after, begins or ends inside a run of Latin letters and digits
+func crossesWord(before, first, last, after rune) bool {
+	return isAlnum(before) && isAlnum(first) || isAlnum(last) && isAlnum(after)
+}
+
+func isAlnum(r rune) bool {
+	return trie.IsWordRune(r)
+}
+
+func isHanzi(r rune) bool {
+	return unicode.Is(unicode.Han, r)
+}
+
+// mergeMatches adds the extra matches not already found and keeps the matches
+// ordered by end position
+func (d *Detector) mergeMatches(matches, extra []Match) []Match {
+	if len(extra) == 0 {
+		return matches
+	}
+	for _, p := range extra {
+		if !slices.ContainsFunc(matches, func(m Match) bool {
+			return m.Start == p.Start && m.End == p.End && m.Word == p.Word
+		}) {
+			matches = append(matches, p)
 		}
+	}
+	slices.SortStableFunc(matches, func(a, b Match) int { return cmp.Compare(a.End, b.End) })
+	return matches
+}
 
-		result.FilteredText = string(*filtered)
+// newMatch maps a match over normalized runes back to the input text
+func newMatch(text string, normalized *normalizer.Text, m trie.Match) Match {
+	start, end, byteStart, byteEnd := normalized.Span(m.Start, m.End)
+	return Match{
+		Word:      m.Word,
+		Start:     start,
+		End:       end,
+		ByteStart: byteStart,
+		ByteEnd:   byteEnd,
+		Matched:   text[byteStart:byteEnd],
+		Level:     Level(m.Level),
 	}
+}
 
-	*bufPtr = (*bufPtr)[:0]
-	d.runePool.Put(bufPtr)
-	return result
+// span, byte range of text rewritten by filter
+type span struct {
+	start    int            // Byte offset of the span
+	end      int            // Byte offset just past the span
+	replace  string         // Replacement of the word, written instead of the filter strategy
+	strategy FilterStrategy // Filter strategy of the word's category
+}
+
+// filter rewrites the matched spans of text and copies every other byte as is.
+// Where spans overlap, the part already rewritten is skipped
+func (d *Detector) filter(snap *snapshot, text string, matches []Match) string {
+	spans := make([]span, 0, len(matches))
+	for _, m := range matches {
+		strategy, ok := d.opts.CategoryStrategies[m.Category]
+		if !ok {
+			strategy = d.opts.FilterStrategy
+		}
+		spans = append(spans, span{
+			start:    m.ByteStart,
+			end:      m.ByteEnd,
+			replace:  snap.wordOpts[m.Word].Replace,
+			strategy: strategy,
+		})
+	}
+	slices.SortFunc(spans, func(a, b span) int {
+		return cmp.Or(cmp.Compare(a.start, b.start), cmp.Compare(b.end, a.end))
+	})
+
+	var sb strings.Builder
+	sb.Grow(len(text))
+	last := 0
+	for _, span := range spans {
+		start := max(span.start, last)
+		if span.end <= start {
+			continue
+		}
+		sb.WriteString(text[last:start])
+		if span.replace != "" {
+			sb.WriteString(span.replace)
+		} else if span.strategy != StrategyRemove {
+			replaceChar := d.opts.ReplaceChar
+			if span.strategy == StrategyMask {
+				replaceChar = '*'
+			}
+			for range text[start:span.end] {
+				sb.WriteRune(replaceChar)
+			}
+		}
+		last = span.end
+	}
+	sb.WriteString(text[last:])
+	return sb.String()
 }
 
 func (d *Detector) Filter(text string) string {
 	return d.Detect(text).FilteredText
 }
 
+// Contains reports whether text holds a word of the detector's minimum level
+// or above, see WithMinLevel
 func (d *Detector) Contains(text string) bool {
+	return d.ContainsLevel(text, d.opts.MinLevel)
+}
+
+// ContainsLevel reports whether text holds a word of level min or above, such
+// as ContainsLevel(text, LevelHigh). Lower words are passed over inside the
+// automaton, no matches are collected
+func (d *Detector) ContainsLevel(text string, min Level) bool {
 	if text == "" {
 		return false
 	}
 
-	bufPtr := d.runePool.Get().(*[]rune)
-	if cap(*bufPtr) < len(text) {
-		*bufPtr = make([]rune, 0, len(text))
+	snap := d.snapshot()
+	min = max(min, LevelLow)
+	var has bool
+	if snap.normalizer.InPlace() {
+		bufPtr := d.runePool.Get().(*[]rune)
+		if cap(*bufPtr) < len(text) {
+			*bufPtr = make([]rune, 0, len(text))
+		}
+		runes := snap.normalizer.ToRunes(text, *bufPtr)
+		has = snap.tree.Contains(runes, d.skipFunc(), int(min))
+		if cap(*bufPtr) <= maxPooled {
+			d.runePool.Put(bufPtr)
+		}
+	} else {
+		// NFKC and rewrites that change the rune count go through a pooled
+		// Text, which keeps the hot path free of allocations
+		normalized := d.textPool.Get().(*normalizer.Text)
+		snap.normalizer.ToText(text, normalized)
+		has = snap.tree.Contains(normalized.Runes, d.skipFunc(), int(min))
+		d.putText(normalized)
 	}
-	runes := d.normalizer.ToRunes(text, *bufPtr)
-
-	d.mu.RLock()
-	if !d.built.Load() {
-		d.mu.RUnlock()
-		d.runePool.Put(bufPtr)
-		return false
+	// Allowlisted phrases, the match mode and the extra passes need the match
+	// positions
+	if has && (snap.filtered() || d.opts.MatchMode != MatchAll) || !has && (snap.phonetic != nil || snap.components != nil) {
+		return d.findFirst(text, min) != nil
 	}
-	has := d.tree.Contains(runes)
-	d.mu.RUnlock()
-
-	d.runePool.Put(bufPtr)
 	return has
 }
 
+// FindFirst returns the first match of the detector's minimum level or above,
+// see WithMinLevel
 func (d *Detector) FindFirst(text string) *Match {
+	return d.findFirst(text, d.opts.MinLevel)
+}
+
+func (d *Detector) findFirst(text string, min Level) *Match {
 	if text == "" {
 		return nil
 	}
-
-	bufPtr := d.runePool.Get().(*[]rune)
-	if cap(*bufPtr) < len(text) {
-		*bufPtr = make([]rune, 0, len(text))
-	}
-	runes := d.normalizer.ToRunes(text, *bufPtr)
-
-	d.mu.RLock()
-	if !d.built.Load() {
-		d.mu.RUnlock()
-		d.runePool.Put(bufPtr)
+	min = max(min, LevelLow)
+
+	snap := d.snapshot()
+	normalized := d.textPool.Get().(*normalizer.Text)
+	defer d.putText(normalized)
+	snap.normalizer.ToText(text, normalized)
+
+	// The match mode may prefer a match that ends later than the first
+	if snap.filtered() || d.opts.MatchMode != MatchAll {
+		matches := d.matches(snap, text, normalized, nil)
+		if i := slices.IndexFunc(matches, func(m Match) bool { return m.Level >= min }); i >= 0 {
+			return &matches[i]
+		}
 		return nil
 	}
-	m := d.tree.FindFirst(runes)
-	d.mu.RUnlock()
 
-	d.runePool.Put(bufPtr)
-	if m == nil {
-		return nil
+	var found *Match
+	if m := snap.tree.FindFirst(normalized.Runes, d.skipFunc(), int(min)); m != nil {
+		match := newMatch(text, normalized, *m)
+		found = &match
 	}
-	return &Match{Word: m.Word, Start: m.Start, End: m.End, Level: Level(m.Level)}
+	if snap.phonetic != nil {
+		if p := d.phoneticMatches(snap, text, normalized, min, true); len(p) > 0 && (found == nil || p[0].End < found.End) {
+			found = &p[0]
+		}
+	}
+	if snap.components != nil {
+		if s := d.splitMatches(snap, text, normalized, min, true); len(s) > 0 && (found == nil || s[0].End < found.End) {
+			found = &s[0]
+		}
+	}
+	if found != nil {
+		found.Category = snap.wordOpts[found.Word].Category
+	}
+	return found
 }
 
 func (d *Detector) FindAll(text string) []string {
@@ -239,7 +1082,7 @@ func (d *Detector) FindAll(text string) []string {
 func (d *Detector) IsVariantEnabled() bool {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
-	return d.opts.EnableVariant && normalizer.IsVariantLoaded()
+	return d.opts.EnableVariant && d.normalizer.IsVariantLoaded()
 }
 
 func (d *Detector) LoadDict(path string) error {
@@ -248,139 +1091,334 @@ func (d *Detector) LoadDict(path string) error {
 }
 
 func (d *Detector) LoadDictWithLevel(path string, level Level) error {
-	if !level.IsValid() {
-		return errors.New("invalid level")
-	}
+	return d.LoadDictWithOptions(path, level, WordOptions{})
+}
 
-	words, err := loadFile(path)
+func (d *Detector) LoadDictFromURL(url string) error {
+	level := inferLevel(url)
+	return d.LoadDictFromURLWithLevel(url, level)
+}
+
+func (d *Detector) LoadDictFromURLWithLevel(url string, level Level) error {
+	return d.LoadDictFromURLWithOptions(url, level, WordOptions{})
+}
+
+// LoadDictFromURLWithOptions loads the dictionary at url like
+// LoadDictWithOptions loads a file
+func (d *Detector) LoadDictFromURLWithOptions(url string, level Level, opts WordOptions) error {
+	entries, err := sourceEntries(DictSource{Name: url, Kind: SourceURL, Options: opts}, level)
 	if err != nil {
 		return err
 	}
+	return d.addEntries(entries, nil)
+}
 
-	wordMap := make(map[string]Level, len(words))
-	for _, word := range words {
-		wordMap[word] = level
+func (d *Detector) LoadDictFromURLs(urls []string) error {
+	for _, url := range urls {
+		if err := d.LoadDictFromURL(url); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return d.AddWords(wordMap)
+// LoadDictWithOptions loads the dictionary at path like LoadDictWithLevel and
+// gives every word the attributes in opts, such as BoundaryWord for a list
+// of English terms. Attributes written on a line take precedence, and an
+// empty category is named after the file, see inferCategory
+func (d *Detector) LoadDictWithOptions(path string, level Level, opts WordOptions) error {
+	entries, err := sourceEntries(DictSource{Name: path, Kind: SourceFile, Options: opts}, level)
+	if err != nil {
+		return err
+	}
+	return d.addEntries(entries, nil)
 }
 
-func (d *Detector) LoadDictFromURL(url string) error {
-	level := inferLevel(url)
-	return d.LoadDictFromURLWithLevel(url, level)
+// Load loads the dictionaries of plan in order of priority, stopping at the
+// first that fails, and reports the words added by several of them with
+// different levels or options. The detector's ConflictPolicy decides which
+// addition of such a word is kept
+func (d *Detector) Load(plan LoadPlan) (*LoadReport, error) {
+	report := &LoadReport{Sources: make([]string, 0, len(plan))}
+	var conflicts []Conflict
+	for _, source := range plan.ordered() {
+		level := source.Level
+		if level == 0 {
+			level = inferLevel(source.Name)
+		}
+		entries, err := sourceEntries(source, level)
+		if err != nil {
+			return nil, err
+		}
+		if err := d.addEntries(entries, &conflicts); err != nil {
+			return nil, err
+		}
+		report.Sources = append(report.Sources, source.Name)
+	}
+	report.Duplicates = duplicates(conflicts)
+	return report, nil
 }
 
-func (d *Detector) LoadDictFromURLWithLevel(url string, level Level) error {
+// sourceEntries reads the words of source with level, an empty category is
+// named after the dictionary, see inferCategory
+func sourceEntries(source DictSource, level Level) ([]dictEntry, error) {
 	if !level.IsValid() {
-		return errors.New("invalid level")
+		return nil, errors.New("invalid level")
+	}
+	opts := source.Options
+	if opts.Category == "" {
+		opts.Category = inferCategory(source.Name)
+	}
+	switch source.Kind {
+	case SourceFile:
+		return loadFile(source.Name, level, opts)
+	case SourceEmbedded:
+		return loadEmbedded("dict", source.Name, level, opts)
+	case SourceURL:
+		return loadURL(source.Name, level, opts)
 	}
+	return nil, errors.New("invalid source kind")
+}
 
-	words, err := loadURL(url)
-	if err != nil {
-		return err
+// ordered returns the sources of p sorted by priority, keeping plan order
+// between equal priorities
+func (p LoadPlan) ordered() LoadPlan {
+	sorted := slices.Clone(p)
+	slices.SortStableFunc(sorted, func(a, b DictSource) int { return cmp.Compare(a.Priority, b.Priority) })
+	return sorted
+}
+
+// duplicates groups conflicts by the word they were about, following the
+// word in effect when a differently written word replaced it
+func duplicates(conflicts []Conflict) []Duplicate {
+	var dups []Duplicate
+	index := make(map[string]int, len(conflicts))
+	for _, c := range conflicts {
+		i, ok := index[c.Winner.Word]
+		if !ok {
+			i, ok = index[c.Loser.Word]
+		}
+		if !ok {
+			i = len(dups)
+			dups = append(dups, Duplicate{})
+		}
+		delete(index, c.Loser.Word)
+		index[c.Winner.Word] = i
+		dups[i].Winner = c.Winner
+		dups[i].Losers = append(dups[i].Losers, c.Loser)
 	}
+	return dups
+}
 
-	wordMap := make(map[string]Level, len(words))
-	for _, word := range words {
-		wordMap[word] = level
+func (d *Detector) addEntries(entries []dictEntry, log *[]Conflict) error {
+	for _, e := range entries {
+		if err := d.add(e, log); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	return d.AddWords(wordMap)
+// LoadAllowDict allowlists every phrase in the word list at path, see
+// AddAllowWord
+func (d *Detector) LoadAllowDict(path string) error {
+	entries, err := loadFile(path, LevelMedium, WordOptions{})
+	if err != nil {
+		return err
+	}
+	return d.addAllowEntries(entries)
 }
 
-func (d *Detector) LoadDictFromURLs(urls []string) error {
-	for _, url := range urls {
-		if err := d.LoadDictFromURL(url); err != nil {
+// addAllowEntries allowlists the words of a parsed word list
+func (d *Detector) addAllowEntries(entries []dictEntry) error {
+	for _, e := range entries {
+		if err := d.AddAllowWord(e.word); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+// LoadVariantMap merges the "variant<TAB>standard" table at path into this
+// detector's variant map, it takes effect on the next Build
 func (d *Detector) LoadVariantMap(path string) error {
-	return normalizer.LoadVariantMap(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return d.LoadVariantMapFromReader(file)
+}
+
+func (d *Detector) LoadVariantMapFromReader(r io.Reader) error {
+	rules, err := normalizer.ParseVariantMap(r)
+	if err != nil {
+		return err
+	}
+	d.AddVariantRules(rules)
+	return nil
+}
+
+func (d *Detector) LoadVariantMapFS(fsys fs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return d.LoadVariantMapFromReader(file)
+}
+
+// AddVariants merges variant→standard character pairs into this detector's
+// variant map, later entries override earlier ones
+func (d *Detector) AddVariants(variants map[rune]rune) {
+	rules := make(map[string]string, len(variants))
+	for from, to := range variants {
+		rules[string(from)] = string(to)
+	}
+	d.AddVariantRules(rules)
+}
+
+// AddVariantRules merges variant→standard rewrite rules whose sides may span
+// several characters, such as "㎏" → "kg" or "v1agra" → "viagra". The longest
+// rule wins where several apply, and matches still report input offsets
+func (d *Detector) AddVariantRules(rules map[string]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.normalizer.AddVariants(rules)
+	d.rekey()
 }
 
 func (d *Detector) Stats() *Stats {
 	d.mu.RLock()
 	defer d.mu.RUnlock()
 
-	return &Stats{
-		TotalWords: d.count,
-		TreeDepth:  d.tree.Size(),
-		MemorySize: d.tree.MemoryUsage(),
+	stats := &Stats{TotalWords: d.count}
+	if snap := d.current.Load(); snap != nil {
+		stats.TreeDepth = snap.tree.Size()
+		stats.MemorySize = snap.tree.MemoryUsage()
+		for _, tree := range []*trie.Tree{snap.allow, snap.phonetic} {
+			if tree != nil {
+				stats.MemorySize += tree.MemoryUsage()
+			}
+		}
+	}
+	return stats
+}
+
+func (d *Detector) keyOf(normalized string) string {
+	if skip := d.skipFunc(); skip != nil {
+		return normalizer.StripNoise(normalized, skip)
 	}
+	return normalized
+}
+
+func (d *Detector) skipFunc() func(rune) bool {
+	if !d.opts.SkipWhitespace {
+		return nil
+	}
+	if d.opts.SkipFunc != nil {
+		return d.opts.SkipFunc
+	}
+	return normalizer.IsNoise
 }
 
 func (d *Detector) Validate(text string) bool {
 	return d.Detect(text).HasSensitive
 }
 
+// IsNoise reports whether r is skipped between word characters by default:
+// whitespace, punctuation, format characters such as zero-width joiners,
+// variation selectors and symbols such as emoji
+func IsNoise(r rune) bool {
+	return normalizer.IsNoise(r)
+}
+
+// LoadDictDir reads the words of every dictionary in dir, see DirPlan. A word
+// in several files gets its level from the file loaded last
 func LoadDictDir(dir string) (map[string]Level, error) {
-	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	plan, err := DirPlan(dir)
 	if err != nil {
 		return nil, err
 	}
 
 	words := make(map[string]Level)
-	for _, file := range files {
-		if strings.HasSuffix(file, ".example.txt") {
-			continue
-		}
-
-		level := inferLevel(file)
-		fileWords, err := loadFile(file)
+	for _, source := range plan.ordered() {
+		entries, err := loadFile(source.Name, source.Level, source.Options)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, word := range fileWords {
-			words[word] = level
+		for _, e := range entries {
+			words[e.word] = e.level
 		}
 	}
 
 	return words, nil
 }
 
-func inferLevel(path string) Level {
-	name := strings.ToLower(filepath.Base(path))
-
-	if strings.HasPrefix(name, "low_") {
-		return LevelLow
+// DirPlan returns a plan of the *.txt dictionaries in dir, less the
+// *.example.txt ones. Each file gets the level inferred from its name as
+// priority, so the most severe file wins a duplicated word, and files of the
+// same level load in name order
+func DirPlan(dir string) (LoadPlan, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil {
+		return nil, err
 	}
-	if strings.HasPrefix(name, "high_") {
-		return LevelHigh
+
+	plan := make(LoadPlan, 0, len(files))
+	for _, file := range files {
+		if strings.HasSuffix(file, ".example.txt") {
+			continue
+		}
+		level := inferLevel(file)
+		plan = append(plan, DictSource{Name: file, Kind: SourceFile, Level: level, Priority: int(level)})
 	}
+	return plan, nil
+}
 
+// inferLevel reads the level from the file name prefix, such as "high_" or
+// the name of a registered level, and defaults to LevelMedium
+func inferLevel(path string) Level {
+	if level, _, ok := levelPrefix(path); ok {
+		return level
+	}
 	return LevelMedium
 }
 
-func loadFile(path string) ([]string, error) {
+// levelPrefix finds the level whose name followed by "_" starts the file name
+// of path, ignoring case, and returns the file name without it
+func levelPrefix(path string) (Level, string, bool) {
+	name := strings.ToLower(filepath.Base(path))
+	for _, level := range Levels() {
+		if rest, ok := strings.CutPrefix(name, strings.ToLower(level.String())+"_"); ok {
+			return level, rest, true
+		}
+	}
+	return 0, name, false
+}
+
+// inferCategory names the category of a dictionary after its file, less the
+// level prefix and the extension: "high_politics.txt" is "politics"
+func inferCategory(path string) string {
+	_, name, _ := levelPrefix(path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+func loadFile(path string, level Level, opts WordOptions) ([]dictEntry, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	words := make([]string, 0, 512)
-	scanner := bufio.NewScanner(file)
-
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		line = strings.TrimSuffix(line, ",")
-		line = strings.TrimSpace(line)
-		if line != "" {
-			words = append(words, line)
-		}
-	}
-
-	return words, scanner.Err()
+	return parseDict(file, path, level, opts)
 }
 
-func loadURL(url string) ([]string, error) {
+func loadURL(url string, level Level, opts WordOptions) ([]dictEntry, error) {
 	resp, err := http.Get(url)
 	if err != nil {
 		return nil, err
@@ -391,20 +1429,112 @@ func loadURL(url string) ([]string, error) {
 		return nil, errors.New("failed to fetch dictionary: " + resp.Status)
 	}
 
-	words := make([]string, 0, 512)
-	scanner := bufio.NewScanner(resp.Body)
+	return parseDict(resp.Body, url, level, opts)
+}
+
+// dictEntry, word read from a dictionary together with its attributes
+type dictEntry struct {
+	word   string      // Word as written in the dictionary
+	level  Level       // Level of the word
+	opts   WordOptions // Attributes of the word
+	source string      // Dictionary the word was read from, empty for AddWord
+}
+
+// same reports whether o adds its word with the same level and options as e,
+// however it is spelled and wherever it comes from
+func (e *dictEntry) same(o dictEntry) bool {
+	return e.level == o.level && e.opts == o.opts
+}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line == "" || strings.HasPrefix(line, "#") {
+func (e *dictEntry) wordSource() WordSource {
+	return WordSource{Word: e.word, Source: e.source, Level: e.level, Options: e.opts}
+}
+
+// parseDict reads a dictionary, one word per line with an optional trailing
+// comma, blank lines and lines starting with # are skipped. The word may be
+// followed by TAB separated attributes that override level and opts for it:
+//
+//	word<TAB>level=high<TAB>category=ad<TAB>boundary=word<TAB>replace=***
+//
+// An unknown, repeated or invalid attribute is reported as a *ParseError
+func parseDict(r io.Reader, source string, level Level, opts WordOptions) ([]dictEntry, error) {
+	entries := make([]dictEntry, 0, 512)
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if trimmed := strings.TrimSpace(text); trimmed == "" || strings.HasPrefix(trimmed, "#") {
 			continue
 		}
-		line = strings.TrimSuffix(line, ",")
-		line = strings.TrimSpace(line)
-		if line != "" {
-			words = append(words, line)
+
+		fields := strings.Split(text, "\t")
+		entry := dictEntry{
+			word:   strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fields[0]), ",")),
+			level:  level,
+			opts:   opts,
+			source: source,
+		}
+		if entry.word == "" {
+			if len(fields) == 1 {
+				continue
+			}
+			return nil, &ParseError{Source: source, Line: line, Msg: "missing word"}
+		}
+		seen := make(map[string]bool, len(fields)-1)
+		for _, field := range fields[1:] {
+			field = strings.TrimSpace(field)
+			if field == "" {
+				continue
+			}
+			key, value, ok := strings.Cut(field, "=")
+			if !ok {
+				return nil, &ParseError{Source: source, Line: line, Msg: "attribute " + strconv.Quote(field) + " is not key=value"}
+			}
+			if seen[key] {
+				return nil, &ParseError{Source: source, Line: line, Msg: "repeated attribute " + strconv.Quote(key)}
+			}
+			seen[key] = true
+			if msg := entry.set(key, value); msg != "" {
+				return nil, &ParseError{Source: source, Line: line, Msg: msg}
+			}
 		}
+		entries = append(entries, entry)
 	}
 
-	return words, scanner.Err()
+	return entries, scanner.Err()
+}
+
+// set applies the attribute key=value to e, it returns why the attribute is
+// invalid or an empty string
+func (e *dictEntry) set(key, value string) string {
+	switch key {
+	case "level":
+		level, ok := ParseLevel(value)
+		if !ok {
+			return "invalid level " + strconv.Quote(value)
+		}
+		e.level = level
+	case "category":
+		if value == "" {
+			return "empty category"
+		}
+		e.opts.Category = value
+	case "boundary":
+		switch value {
+		case "none":
+			e.opts.Boundary = BoundaryNone
+		case "word":
+			e.opts.Boundary = BoundaryWord
+		default:
+			return "invalid boundary " + strconv.Quote(value)
+		}
+	case "replace":
+		if value == "" {
+			return "empty replacement"
+		}
+		e.opts.Replace = value
+	default:
+		return "unknown attribute " + strconv.Quote(key)
+	}
+	return ""
 }
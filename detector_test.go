@@ -4,9 +4,19 @@
 package sensitive
 
 import (
+	"context"
+	"errors"
+	"io"
 	"os"
+	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
+	"testing/fstest"
+	"testing/iotest"
+
+	"github.com/Done-0/sensitive/internal/normalizer"
 )
 
 func TestNew(t *testing.T) {
@@ -60,6 +70,55 @@ func TestBuild(t *testing.T) {
 	}
 }
 
+func TestAddWord_AfterBuild(t *testing.T) {
+	detector := New()
+	detector.AddWord("bad", LevelHigh)
+	detector.Build()
+	if err := detector.AddWord("ugly", LevelLow); err != nil {
+		t.Fatalf("AddWord() after Build() error: %v", err)
+	}
+	if !detector.Contains("bad") {
+		t.Error("previous build should keep serving until rebuilt")
+	}
+	if detector.Contains("ugly") {
+		t.Error("new word should not be visible before Build()")
+	}
+	detector.Build()
+	if !detector.Contains("ugly") || !detector.Contains("bad") {
+		t.Error("rebuild should include old and new words")
+	}
+}
+
+func TestRemoveWord(t *testing.T) {
+	detector := New()
+	detector.AddWords(map[string]Level{"bad": LevelHigh, "badge": LevelLow, "ugly": LevelLow})
+	detector.Build()
+	if err := detector.RemoveWords([]string{"BAD", "ugly", "missing"}); err != nil {
+		t.Fatalf("RemoveWords() error: %v", err)
+	}
+	detector.Build()
+	if detector.Contains("bad ugly") {
+		t.Error("removed words should not match")
+	}
+	if !detector.Contains("badge") {
+		t.Error("words sharing a prefix with a removed word should still match")
+	}
+	if got := detector.Stats().TotalWords; got != 1 {
+		t.Errorf("expected 1 word, got %d", got)
+	}
+	if err := detector.RemoveWord(""); err == nil {
+		t.Error("RemoveWord() should return error for empty word")
+	}
+
+	// Options are dropped with the word under the spelling it was added with
+	detector = NewBuilder().AddWordWithOptions("Sex", LevelMedium, WordOptions{Boundary: BoundaryWord}).MustBuild()
+	detector.RemoveWord("sex")
+	detector.Build()
+	if len(detector.wordOpts) != 0 || detector.snapshot().bounded {
+		t.Errorf("expected no word options left, got %v", detector.wordOpts)
+	}
+}
+
 func TestDetect_Empty(t *testing.T) {
 	detector := New()
 	detector.AddWord("test", LevelMedium)
@@ -132,6 +191,38 @@ func TestDetect_Chinese(t *testing.T) {
 	}
 }
 
+func TestDetect_ByteOffsets(t *testing.T) {
+	detector := New()
+	detector.AddWord("敏感词", LevelHigh)
+	detector.AddWord("bad", LevelHigh)
+	detector.Build()
+	text := "这是敏感词和ＢＡＤ"
+	result := detector.Detect(text)
+	if len(result.Matches) != 2 {
+		t.Fatalf("expected 2 matches, got %d", len(result.Matches))
+	}
+	want := []struct {
+		start, end, byteStart, byteEnd int
+		matched                        string
+	}{
+		{2, 5, 6, 15, "敏感词"},
+		{6, 9, 18, 27, "ＢＡＤ"},
+	}
+	for i, w := range want {
+		m := result.Matches[i]
+		if m.Start != w.start || m.End != w.end || m.ByteStart != w.byteStart || m.ByteEnd != w.byteEnd {
+			t.Errorf("match %d: got %d-%d bytes %d-%d, want %d-%d bytes %d-%d",
+				i, m.Start, m.End, m.ByteStart, m.ByteEnd, w.start, w.end, w.byteStart, w.byteEnd)
+		}
+		if m.Matched != w.matched || text[m.ByteStart:m.ByteEnd] != w.matched {
+			t.Errorf("match %d: Matched = %q, want %q", i, m.Matched, w.matched)
+		}
+	}
+	if m := detector.FindFirst(text); m == nil || m.ByteStart != 6 || m.ByteEnd != 15 || m.Matched != "敏感词" {
+		t.Errorf("FindFirst() = %+v, want bytes 6-15", m)
+	}
+}
+
 func TestFilter_Mask(t *testing.T) {
 	detector := New(WithFilterStrategy(StrategyMask))
 	detector.AddWord("bad", LevelHigh)
@@ -154,6 +245,39 @@ func TestFilter_Replace(t *testing.T) {
 	}
 }
 
+func TestFilter_PreservesOriginal(t *testing.T) {
+	tests := []struct {
+		strategy FilterStrategy
+		want     string
+	}{
+		{StrategyMask, "Hello *** Ｗorld，敏**"},
+		{StrategyReplace, "Hello ### Ｗorld，敏##"},
+		{StrategyRemove, "Hello  Ｗorld，敏"},
+	}
+	for _, tt := range tests {
+		detector := NewBuilder().
+			WithFilterStrategy(tt.strategy).
+			WithReplaceChar('#').
+			AddWord("bad", LevelHigh).
+			AddWord("感词", LevelHigh).
+			MustBuild()
+		if got := detector.Filter("Hello BAD Ｗorld，敏感词"); got != tt.want {
+			t.Errorf("strategy %d: expected '%s', got '%s'", tt.strategy, tt.want, got)
+		}
+	}
+}
+
+func TestFilter_Overlapping(t *testing.T) {
+	detector := NewBuilder().
+		AddWord("出售炸药", LevelHigh).
+		AddWord("炸药", LevelHigh).
+		AddWord("药品", LevelLow).
+		MustBuild()
+	if got := detector.Filter("出售炸药品"); got != "*****" {
+		t.Errorf("expected '*****', got '%s'", got)
+	}
+}
+
 func TestValidate(t *testing.T) {
 	detector := New()
 	detector.AddWord("bad", LevelHigh)
@@ -235,6 +359,85 @@ func TestConcurrent(t *testing.T) {
 	wg.Wait()
 }
 
+func TestDetect_WithoutBuild(t *testing.T) {
+	detector := New()
+	detector.AddWord("bad", LevelHigh)
+	if !detector.Contains("this is bad") {
+		t.Error("should build on first use instead of reporting clean")
+	}
+}
+
+func TestReload(t *testing.T) {
+	detector := NewBuilder().
+		WithFilterStrategy(StrategyReplace).
+		WithReplaceChar('#').
+		AddWord("old", LevelHigh).
+		MustBuild()
+	err := detector.Reload(func(next *Detector) error {
+		return next.AddWords(map[string]Level{"new": LevelHigh, "newer": LevelLow})
+	})
+	if err != nil {
+		t.Fatalf("Reload() error: %v", err)
+	}
+	if detector.Contains("old") {
+		t.Error("reload should replace the previous words")
+	}
+	if got := detector.Filter("new"); got != "###" {
+		t.Errorf("reload should keep options, got '%s'", got)
+	}
+	if detector.Stats().TotalWords != 2 {
+		t.Error("expected 2 words")
+	}
+
+	if err := detector.Reload(func(next *Detector) error {
+		return next.AddWord("", LevelHigh)
+	}); err == nil {
+		t.Error("Reload() should return the load error")
+	}
+	if !detector.Contains("new") {
+		t.Error("failed reload should keep the current words")
+	}
+
+	// The allowlist is carried into the reloaded dictionary
+	detector = NewBuilder().
+		AddWord("网络", LevelLow).
+		AddAllowWord("网络安全").
+		MustBuild()
+	if err := detector.Reload(func(next *Detector) error {
+		return next.AddWord("网络", LevelMedium)
+	}); err != nil {
+		t.Fatalf("Reload() error: %v", err)
+	}
+	if detector.Contains("网络安全") || !detector.Contains("网络") {
+		t.Error("reload should keep the allowlist")
+	}
+}
+
+func TestReload_Concurrent(t *testing.T) {
+	detector := New()
+	detector.AddWord("test", LevelMedium)
+	detector.Build()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				if !detector.Contains("a test text") {
+					t.Error("readers should always see a built automaton")
+					return
+				}
+			}
+		}()
+	}
+	for range 5 {
+		detector.Reload(func(next *Detector) error {
+			return next.AddWord("test", LevelHigh)
+		})
+	}
+	wg.Wait()
+}
+
 func TestLevelString(t *testing.T) {
 	tests := []struct {
 		level Level
@@ -339,9 +542,14 @@ func TestBuilder_MustBuild_Panic(t *testing.T) {
 }
 
 func TestLoadAllEmbedded(t *testing.T) {
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
 	detector := NewBuilder().
 		LoadAllEmbedded().
 		MustBuild()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
 	stats := detector.Stats()
 	if stats.TotalWords == 0 {
 		t.Error("LoadAllEmbedded() should load words")
@@ -349,6 +557,27 @@ func TestLoadAllEmbedded(t *testing.T) {
 	if stats.TotalWords < 1000 {
 		t.Errorf("expected > 1000 words, got %d", stats.TotalWords)
 	}
+	// The words are kept by key rather than in a trie, and the conflict
+	// history is capped
+	if heap := int64(after.HeapAlloc) - int64(before.HeapAlloc); heap > 48<<20 {
+		t.Errorf("expected under 48 MB of heap, got %d MB", heap>>20)
+	}
+	if got := len(detector.Conflicts()); got != maxConflicts {
+		t.Errorf("expected the latest %d conflicts, got %d", maxConflicts, got)
+	}
+	runtime.KeepAlive(detector)
+
+	report, err := New().Load(EmbeddedPlan())
+	if err != nil {
+		t.Fatal(err)
+	}
+	losers := 0
+	for _, dup := range report.Duplicates {
+		losers += len(dup.Losers)
+	}
+	if losers <= maxConflicts {
+		t.Errorf("expected Load to report every conflict, got %d", losers)
+	}
 }
 
 func TestLoadEmbeddedDict(t *testing.T) {
@@ -409,8 +638,71 @@ func TestSkipWhitespace(t *testing.T) {
 		WithSkipWhitespace(true).
 		AddWord("bad", LevelHigh).
 		MustBuild()
-	result := detector.Detect("b a d")
-	t.Logf("Detected: %v, Matches: %d", result.HasSensitive, len(result.Matches))
+	result := detector.Detect("so b a d!")
+	if len(result.Matches) != 1 {
+		t.Fatalf("expected 1 match, got %d", len(result.Matches))
+	}
+	if m := result.Matches[0]; m.Start != 3 || m.End != 8 {
+		t.Errorf("expected span 3-8, got %d-%d", m.Start, m.End)
+	}
+	if result.FilteredText != "so *****!" {
+		t.Errorf("expected 'so *****!', got '%s'", result.FilteredText)
+	}
+	for _, text := range []string{"b\u200ba\u200dd", "b.a.d", "b\u3000a\td"} {
+		if !detector.Contains(text) {
+			t.Errorf("should skip noise in %q", text)
+		}
+	}
+	if m := detector.FindFirst("x b-a-d"); m == nil || m.Start != 2 || m.End != 7 {
+		t.Errorf("FindFirst() = %+v, want span 2-7", m)
+	}
+
+	// Noise is only skipped inside matches standing as whole words
+	detector = NewBuilder().AddWord("ass", LevelHigh).MustBuild()
+	for _, text := range []string{"I was seen", "gla s s", "a sset"} {
+		if got := detector.Filter(text); got != text {
+			t.Errorf("Filter(%q) = %q, want it unchanged", text, got)
+		}
+		if detector.Contains(text) || detector.FindFirst(text) != nil {
+			t.Errorf("%q should not match across a word break", text)
+		}
+	}
+	if got := detector.Filter("an a s s!"); got != "an *****!" {
+		t.Errorf("Filter() = %q, want 'an *****!'", got)
+	}
+
+	embedded := NewBuilder().LoadAllEmbedded().MustBuild()
+	for _, m := range embedded.Detect("I will yield").Matches {
+		if strings.Contains(m.Matched, " ") {
+			t.Errorf("expected no matches across word breaks, got %+v", m)
+		}
+	}
+}
+
+func TestSkipWhitespace_NoiseWord(t *testing.T) {
+	detector := NewBuilder().
+		AddWord("出售炸药 电话", LevelHigh).
+		AddWord("&", LevelLow).
+		MustBuild()
+	if !detector.Contains("出售炸药电话") {
+		t.Error("noise inside dictionary words should be ignored")
+	}
+	if !detector.Contains("a & b") {
+		t.Error("words made only of noise should still match")
+	}
+}
+
+func TestSkipFunc(t *testing.T) {
+	detector := NewBuilder().
+		WithSkipFunc(func(r rune) bool { return r == '_' }).
+		AddWord("bad", LevelHigh).
+		MustBuild()
+	if !detector.Contains("b_a_d") {
+		t.Error("should skip custom noise runes")
+	}
+	if detector.Contains("b a d") {
+		t.Error("should only skip runes accepted by SkipFunc")
+	}
 }
 
 func TestSkipWhitespace_Disabled(t *testing.T) {
@@ -426,6 +718,20 @@ func TestSkipWhitespace_Disabled(t *testing.T) {
 	}
 }
 
+func TestBuild_SiblingSlots(t *testing.T) {
+	// "porn" and "spam" once collided because the subtree of 'p' took the
+	// slot of the later root transition 's'
+	detector := NewBuilder().
+		AddWords(map[string]Level{"porn": LevelHigh, "spam": LevelMedium, "pa": LevelLow, "pb": LevelLow}).
+		MustBuild()
+
+	for _, word := range []string{"porn", "spam", "pa", "pb"} {
+		if !detector.Contains(word) {
+			t.Errorf("expected %q to be detected", word)
+		}
+	}
+}
+
 func TestVariant_Enabled(t *testing.T) {
 	if testing.Short() {
 		t.Skip("skipping variant test")
@@ -440,12 +746,1137 @@ func TestVariant_Enabled(t *testing.T) {
 		AddWord("国", LevelHigh).
 		MustBuild()
 
-	result := detector.Detect("國家")
-	t.Logf("Variant test - Detected: %v, Matches: %d", result.HasSensitive, len(result.Matches))
-
+	if !detector.Detect("國家").HasSensitive {
+		t.Error("should detect traditional Chinese")
+	}
 	if !detector.Detect("国家").HasSensitive {
 		t.Error("should detect simplified Chinese")
 	}
+	if !detector.IsVariantEnabled() {
+		t.Error("IsVariantEnabled() should be true")
+	}
+}
+
+func TestVariant_PerDetector(t *testing.T) {
+	custom := NewBuilder().
+		WithVariant(true).
+		AddWord("囯", LevelHigh).
+		AddVariants(map[rune]rune{'囯': '国'}).
+		MustBuild()
+	plain := NewBuilder().
+		WithVariant(true).
+		AddWord("囯", LevelHigh).
+		MustBuild()
+
+	if !custom.Contains("国家") {
+		t.Error("words added before the variant map should be folded too")
+	}
+	if plain.Contains("国家") {
+		t.Error("variant maps should not leak between detectors")
+	}
+}
+
+func TestVariant_Embedded(t *testing.T) {
+	detector := NewBuilder().
+		WithVariant(true).
+		AddWord("习近平", LevelHigh).
+		AddWord("カート", LevelLow).
+		MustBuild()
+	if !detector.IsVariantEnabled() {
+		t.Error("embedded variant map should be loaded by default")
+	}
+	if !detector.Contains("習近平") {
+		t.Error("should detect traditional Chinese out of the box")
+	}
+	if !detector.Contains("ｶｰﾄ") {
+		t.Error("should fold halfwidth katakana")
+	}
+
+	explicit := New()
+	if err := LoadEmbeddedVariantMap(explicit, VariantTraditional); err != nil {
+		t.Fatalf("LoadEmbeddedVariantMap() error: %v", err)
+	}
+	if !explicit.normalizer.IsVariantLoaded() {
+		t.Error("LoadEmbeddedVariantMap() should load the table")
+	}
+	if err := LoadEmbeddedVariantMap(explicit, "missing.txt"); err == nil {
+		t.Error("should return error for unknown table")
+	}
+}
+
+func TestVariant_Sources(t *testing.T) {
+	fsys := fstest.MapFS{"variants.txt": {Data: []byte("體\t体\n")}}
+	detector := NewBuilder().
+		WithVariant(true).
+		LoadVariantMapFS(fsys, "variants.txt").
+		LoadVariantMapFromReader(strings.NewReader("# comment\n國\t国\n")).
+		AddWords(map[string]Level{"国体": LevelHigh}).
+		MustBuild()
+	if !detector.Contains("國體") {
+		t.Error("variant maps from different sources should compose")
+	}
+
+	detector.AddVariants(map[rune]rune{'囯': '国'})
+	detector.Build()
+	if !detector.Contains("囯體") {
+		t.Error("variants added after Build() should apply on rebuild")
+	}
+}
+
+func TestVariant_MultiRune(t *testing.T) {
+	detector := NewBuilder().
+		WithVariant(true).
+		AddVariantRules(map[string]string{"㎏": "kg", "v1agra": "viagra"}).
+		LoadVariantMapFromReader(strings.NewReader("vv\tw\n")).
+		AddWords(map[string]Level{"viagra": LevelHigh, "10kg": LevelLow, "wow": LevelLow}).
+		MustBuild()
+
+	tests := []struct {
+		text       string
+		matched    string
+		start, end int
+	}{
+		{"Buy V1AGRA now", "V1AGRA", 4, 10},
+		{"重10㎏的包裹", "10㎏", 1, 4},
+		{"vvow!", "vvow", 0, 4},
+	}
+	for _, tt := range tests {
+		m := detector.FindFirst(tt.text)
+		if m == nil {
+			t.Errorf("%q: expected a match", tt.text)
+			continue
+		}
+		if m.Matched != tt.matched || m.Start != tt.start || m.End != tt.end {
+			t.Errorf("%q: got %q at %d-%d, want %q at %d-%d", tt.text, m.Matched, m.Start, m.End, tt.matched, tt.start, tt.end)
+		}
+	}
+	if got := detector.Filter("重10㎏的包裹"); got != "重***的包裹" {
+		t.Errorf("expected '重***的包裹', got '%s'", got)
+	}
+}
+
+func TestConfusableFolding(t *testing.T) {
+	header, err := dictFS.ReadFile("configs/unicode/confusables.txt")
+	if err != nil {
+		t.Fatalf("ReadFile() error: %v", err)
+	}
+	if !strings.Contains(string(header), "Unicode "+normalizer.UnicodeVersion+",") {
+		t.Errorf("expected the confusables table from Unicode %s, the version of the NFKC tables", normalizer.UnicodeVersion)
+	}
+
+	words := map[string]Level{"spam": LevelMedium, "porn": LevelHigh, "敏感词": LevelLow}
+	detector := NewBuilder().
+		WithConfusableFolding(true).
+		AddWords(words).
+		MustBuild()
+
+	tests := []struct {
+		text, word string
+	}{
+		{"buy \u0455\u0440\u0430m now", "spam"},
+		{"\u0405\u0420\u0410M", "spam"},
+		{"p\u03bfrn", "porn"},
+		{"𝐬𝐩𝐚𝐦", "spam"},
+		{"ⓢⓟⓐⓜ", "spam"},
+		{"这是敏感词", "敏感词"},
+	}
+	for _, tt := range tests {
+		m := detector.FindFirst(tt.text)
+		if m == nil {
+			t.Errorf("%q: expected a match", tt.text)
+			continue
+		}
+		if m.Word != tt.word {
+			t.Errorf("%q: expected word %q, got %q", tt.text, tt.word, m.Word)
+		}
+	}
+	if got := detector.Filter("no 𝐬𝐩𝐚𝐦!"); got != "no ****!" {
+		t.Errorf("expected 'no ****!', got '%s'", got)
+	}
+
+	plain := NewBuilder().AddWords(words).MustBuild()
+	if plain.Contains("\u0455\u0440\u0430m") {
+		t.Error("lookalikes should not match without confusable folding")
+	}
+
+	// A match never takes part of the runes a character's skeleton is spelled with
+	partial := NewBuilder().
+		WithConfusableFolding(true).
+		AddWords(map[string]Level{"r": LevelLow, "nt": LevelLow}).
+		MustBuild()
+	for _, text := range []string{"jumps", "mt"} {
+		var scanned []Match
+		if err := partial.ScanReader(strings.NewReader(text), func(m Match) error {
+			scanned = append(scanned, m)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if partial.Contains(text) || partial.FindFirst(text) != nil || len(partial.Detect(text).Matches) != 0 || len(scanned) != 0 {
+			t.Errorf("%q: expected no match inside the skeleton of a character", text)
+		}
+	}
+	if m := partial.FindFirst("r m"); m == nil || m.Start != 0 {
+		t.Errorf("FindFirst() = %+v, want the whole character 'r'", m)
+	}
+
+	embedded := NewBuilder().WithConfusableFolding(true).LoadAllEmbedded().MustBuild()
+	if m := embedded.Detect("jumps").Matches; len(m) != 0 {
+		t.Errorf("expected no matches, got %+v", m)
+	}
+}
+
+func TestNFKC(t *testing.T) {
+	words := map[string]Level{"bad": LevelMedium, "fire": LevelLow, "110": LevelLow, "café": LevelLow, "한국": LevelLow, "ガード": LevelLow}
+	detector := NewBuilder().
+		WithSkipWhitespace(false).
+		WithNFKC(true).
+		AddWords(words).
+		MustBuild()
+
+	tests := []struct {
+		text, word, matched string
+		start, end          int
+	}{
+		{"x b\u200bad y", "bad", "b\u200bad", 2, 6},
+		{"b\u200d\ufeffad", "bad", "b\u200d\ufeffad", 0, 5},
+		{"b\u0338a\u20dfd", "bad", "b\u0338a\u20dfd", 0, 5},
+		{"ﬁre!", "fire", "ﬁre", 0, 3},
+		{"call ①①⓪", "110", "①①⓪", 5, 8},
+		{"le cafe\u0301", "café", "cafe\u0301", 3, 8},
+		{"\u1112\u1161\u11ab\u1100\u116e\u11a8", "한국", "\u1112\u1161\u11ab\u1100\u116e\u11a8", 0, 6},
+		{"ｶﾞｰﾄﾞ", "ガード", "ｶﾞｰﾄﾞ", 0, 5},
+		{"\U0001CCD7\U0001CCD6\U0001CCD9", "bad", "\U0001CCD7\U0001CCD6\U0001CCD9", 0, 3},
+	}
+	for _, tt := range tests {
+		m := detector.FindFirst(tt.text)
+		if m == nil {
+			t.Errorf("%q: expected a match", tt.text)
+			continue
+		}
+		if m.Word != tt.word || m.Matched != tt.matched || m.Start != tt.start || m.End != tt.end {
+			t.Errorf("%q: got %q (%q) at %d-%d, want %q (%q) at %d-%d",
+				tt.text, m.Word, m.Matched, m.Start, m.End, tt.word, tt.matched, tt.start, tt.end)
+		}
+	}
+	if got := detector.Filter("x b\u200bad y"); got != "x **** y" {
+		t.Errorf("expected 'x **** y', got '%s'", got)
+	}
+
+	// NFKC changes the rune count, the pooled Text keeps the hot path free of
+	// allocations all the same
+	clean := "ｃｌｅａｎ ﬁle, call ①②③ now"
+	detector.Contains(clean)
+	if n := testing.AllocsPerRun(100, func() { detector.Contains(clean) }); n != 0 {
+		t.Errorf("Contains: expected 0 allocs with NFKC, got %v", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { detector.FindFirst(clean) }); n != 0 {
+		t.Errorf("FindFirst: expected 0 allocs with NFKC, got %v", n)
+	}
+
+	plain := NewBuilder().WithSkipWhitespace(false).AddWords(words).MustBuild()
+	if plain.Contains("b\u200bad") || plain.Contains("ﬁre") {
+		t.Error("expected no match without NFKC")
+	}
+
+	// A rule whose source NFKC strips to nothing is dropped, not compiled
+	detector, err := NewBuilder().
+		WithNFKC(true).
+		WithVariant(true).
+		LoadVariantMapFromReader(strings.NewReader("\u200b\tx\n國\t国\n")).
+		AddWord("国家", LevelLow).
+		Build()
+	if err != nil {
+		t.Fatalf("Build() error: %v", err)
+	}
+	if !detector.Contains("國\u200b家") {
+		t.Error("expected the other rules to apply")
+	}
+}
+
+func TestLeetFolding(t *testing.T) {
+	words := map[string]Level{"bad": LevelLow, "spam": LevelMedium, "sex": LevelHigh, "shit": LevelMedium, "8964": LevelHigh}
+	detector := NewBuilder().
+		WithLeetFolding(nil).
+		AddWords(words).
+		MustBuild()
+
+	tests := []struct {
+		text, word, matched string
+	}{
+		{"so b4d", "bad", "b4d"},
+		{"$pam here", "spam", "$pam"},
+		{"5ex", "sex", "5ex"},
+		{"SH!T", "shit", "SH!T"},
+		{"sh1t", "shit", "sh1t"},
+		{"六四8964", "8964", "8964"},
+	}
+	for _, tt := range tests {
+		m := detector.FindFirst(tt.text)
+		if m == nil {
+			t.Errorf("%q: expected a match", tt.text)
+			continue
+		}
+		if m.Word != tt.word || m.Matched != tt.matched {
+			t.Errorf("%q: got %q (%q), want %q (%q)", tt.text, m.Word, m.Matched, tt.word, tt.matched)
+		}
+	}
+
+	// Numbers are not ASCII words, so they keep their digits
+	if detector.Contains("bgba") {
+		t.Error("'bgba' should not match '8964' when leet folding is ASCII only")
+	}
+	anywhere := NewBuilder().
+		WithLeetFolding(map[rune]rune{'4': 'a'}).
+		WithLeetASCIIOnly(false).
+		AddWords(map[string]Level{"a货": LevelLow}).
+		MustBuild()
+	if !anywhere.Contains("4货") {
+		t.Error("expected '4货' to match 'a货' with leet folding everywhere")
+	}
+
+	plain := NewBuilder().AddWords(words).MustBuild()
+	if plain.Contains("$pam") {
+		t.Error("leetspeak should not match without leet folding")
+	}
+}
+
+func TestPinyin(t *testing.T) {
+	detector := NewBuilder().
+		WithPinyin(true).
+		WithPinyinInitials(true).
+		AddWords(map[string]Level{"习近平": LevelHigh, "法轮功": LevelHigh, "你好": LevelLow, "好": LevelLow}).
+		MustBuild()
+
+	tests := []struct {
+		text, word, matched string
+	}{
+		{"hi xijinping!", "习近平", "xijinping"},
+		{"XJP", "习近平", "XJP"},
+		{"xi jin ping", "习近平", "xi jin ping"},
+		{"falungong", "法轮功", "falungong"},
+		{"flg", "法轮功", "flg"},
+		{"nihao", "你好", "nihao"},
+		{"习近平", "习近平", "习近平"},
+	}
+	for _, tt := range tests {
+		m := detector.FindFirst(tt.text)
+		if m == nil {
+			t.Errorf("%q: expected a match", tt.text)
+			continue
+		}
+		if m.Word != tt.word || m.Matched != tt.matched {
+			t.Errorf("%q: got %q (%q), want %q (%q)", tt.text, m.Word, m.Matched, tt.word, tt.matched)
+		}
+	}
+	// Single characters and two-letter initials would match ordinary text
+	for _, text := range []string{"hao", "nh"} {
+		if detector.Contains(text) {
+			t.Errorf("%q should not match", text)
+		}
+	}
+	if got := detector.Stats().TotalWords; got != 4 {
+		t.Errorf("expected 4 words, got %d", got)
+	}
+
+	detector.RemoveWord("习近平")
+	detector.Build()
+	if detector.Contains("xijinping") || detector.Contains("xjp") {
+		t.Error("expected pinyin forms to be removed with the word")
+	}
+	if !detector.Contains("flg") {
+		t.Error("expected other pinyin forms to be kept")
+	}
+
+	plain := NewBuilder().AddWord("习近平", LevelHigh).MustBuild()
+	if plain.Contains("xijinping") {
+		t.Error("pinyin should not match without WithPinyin")
+	}
+
+	// Pinyin forms only match whole Latin words, not letters inside English
+	latin := NewBuilder().
+		WithPinyin(true).
+		WithPinyinInitials(true).
+		AddWords(map[string]Level{"共产党": LevelHigh, "日本": LevelLow}).
+		MustBuild()
+	for _, text := range []string{"abgcdef", "Tariben", "ribena", "x gcdy"} {
+		if latin.Contains(text) || latin.Detect(text).HasSensitive {
+			t.Errorf("%q should not match", text)
+		}
+	}
+	for _, text := range []string{"riben", "去riben旅游", "gcd!"} {
+		if !latin.Contains(text) {
+			t.Errorf("%q should match", text)
+		}
+	}
+
+	// Initials are off by default, they often spell ordinary words
+	initials := NewBuilder().
+		WithPinyin(true).
+		AddWord("偷荤二奶", LevelMedium).
+		MustBuild()
+	if initials.Contains("then") || !initials.Contains("touhunernai") {
+		t.Error("expected only the full pinyin without WithPinyinInitials")
+	}
+	embedded := NewBuilder().WithPinyin(true).LoadAllEmbedded().MustBuild()
+	if m := embedded.FindFirst("and then"); m != nil {
+		t.Errorf("expected no match in plain English, got %+v", m)
+	}
+
+	// Removing a word under another spelling removes its pinyin forms too
+	variant := NewBuilder().
+		WithVariant(true).
+		WithPinyin(true).
+		AddWord("國家", LevelLow).
+		MustBuild()
+	variant.RemoveWord("国家")
+	variant.Build()
+	if variant.Contains("guojia") || variant.Contains("國家") {
+		t.Error("expected the word and its pinyin to be removed")
+	}
+}
+
+func TestPhonetic(t *testing.T) {
+	words := map[string]Level{"习近平": LevelHigh, "法轮功": LevelHigh}
+	detector := NewBuilder().
+		WithPhonetic(true).
+		AddWords(words).
+		MustBuild()
+
+	tests := []struct {
+		text, word, matched string
+	}{
+		{"说习jin平的事", "习近平", "习jin平"},
+		{"席近平", "习近平", "席近平"},
+		{"xi近ping", "习近平", "xi近ping"},
+		{"练法lun功", "法轮功", "法lun功"},
+		{"发轮工", "法轮功", "发轮工"},
+		{"习近平", "习近平", "习近平"},
+	}
+	for _, tt := range tests {
+		m := detector.FindFirst(tt.text)
+		if m == nil {
+			t.Errorf("%q: expected a match", tt.text)
+			continue
+		}
+		if m.Word != tt.word || m.Matched != tt.matched {
+			t.Errorf("%q: got %q (%q), want %q (%q)", tt.text, m.Word, m.Matched, tt.word, tt.matched)
+		}
+	}
+
+	// Pure pinyin is WithPinyin's job, and syllables inside words do not count
+	for _, text := range []string{"xijinping", "taxi近pingo", "fast"} {
+		if detector.Contains(text) {
+			t.Errorf("%q should not match", text)
+		}
+	}
+	if result := detector.Detect("席近平和法lun功"); len(result.Matches) != 2 || result.FilteredText != "***和*****" {
+		t.Errorf("expected two masked matches, got %+v", result)
+	}
+
+	plain := NewBuilder().AddWords(words).MustBuild()
+	if plain.Contains("席近平") {
+		t.Error("homophones should not match without phonetic matching")
+	}
+
+	// The pinyin keys are counted in the stats and sized to their letters
+	phonetic := detector.snapshot().phonetic.MemoryUsage()
+	if phonetic > 64<<10 {
+		t.Errorf("expected a small phonetic automaton, got %d bytes", phonetic)
+	}
+	if got, want := detector.Stats().MemorySize, plain.Stats().MemorySize+phonetic; got != want {
+		t.Errorf("expected MemorySize %d, got %d", want, got)
+	}
+}
+
+func TestSplitCharacters(t *testing.T) {
+	words := map[string]Level{"强奸": LevelHigh, "法轮功": LevelHigh, "干部": LevelLow}
+	detector := NewBuilder().
+		WithSplitCharacters(true).
+		AddWords(words).
+		MustBuild()
+
+	tests := []struct {
+		text, word, matched string
+		start, end          int
+	}{
+		{"他弓虽女干了", "强奸", "弓虽女干", 1, 5},
+		{"弓虽奸", "强奸", "弓虽奸", 0, 3},
+		{"练氵去轮功", "法轮功", "氵去轮功", 1, 5},
+		{"强奸", "强奸", "强奸", 0, 2},
+	}
+	for _, tt := range tests {
+		m := detector.FindFirst(tt.text)
+		if m == nil {
+			t.Errorf("%q: expected a match", tt.text)
+			continue
+		}
+		if m.Word != tt.word || m.Matched != tt.matched || m.Start != tt.start || m.End != tt.end {
+			t.Errorf("%q: got %q %q [%d,%d), want %q %q [%d,%d)",
+				tt.text, m.Word, m.Matched, m.Start, m.End, tt.word, tt.matched, tt.start, tt.end)
+		}
+	}
+
+	// Joining components must not hide literal matches
+	if result := detector.Detect("女干部"); len(result.Matches) != 1 || result.Matches[0].Word != "干部" {
+		t.Errorf("expected 干部 only, got %+v", result.Matches)
+	}
+	if result := detector.Detect("弓虽女干"); result.FilteredText != "****" {
+		t.Errorf("expected the components to be masked, got %q", result.FilteredText)
+	}
+
+	plain := NewBuilder().AddWords(words).MustBuild()
+	if plain.Contains("弓虽女干") {
+		t.Error("split characters should not match without WithSplitCharacters")
+	}
+}
+
+func TestAllowWords(t *testing.T) {
+	tmpFile := t.TempDir() + "/allow.txt"
+	if err := os.WriteFile(tmpFile, []byte("# phrases\n边防部队\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	detector := NewBuilder().
+		AddWords(map[string]Level{"网络": LevelLow, "边防": LevelMedium, "络安": LevelLow, "赌博": LevelHigh}).
+		AddAllowWord("网络安全").
+		LoadAllowDict(tmpFile).
+		MustBuild()
+
+	result := detector.Detect("网络安全和边防部队不等于网络赌博")
+	var words []string
+	for _, m := range result.Matches {
+		words = append(words, m.Word)
+	}
+	if !slices.Equal(words, []string{"网络", "赌博"}) || result.Matches[0].Start != 12 {
+		t.Errorf("expected only the last 网络 and 赌博, got %+v", result.Matches)
+	}
+	if result.FilteredText != "网络安全和边防部队不等于****" {
+		t.Errorf("allowlisted phrases should not be filtered, got %q", result.FilteredText)
+	}
+	if detector.Contains("网络安全") || detector.FindFirst("边防 部队") != nil {
+		t.Error("allowlisted phrases should not match")
+	}
+	if m := detector.FindFirst("网络安全的网络"); m == nil || m.Start != 5 {
+		t.Errorf("expected the match after the allowlisted phrase, got %+v", m)
+	}
+	// The double array is sized to the phrases, not to a large dictionary
+	if size := detector.snapshot().allow.MemoryUsage(); size > 4<<20 {
+		t.Errorf("expected a small allowlist automaton, got %d bytes", size)
+	}
+
+	embedded := NewBuilder().
+		AddWords(map[string]Level{"招聘": LevelLow}).
+		LoadEmbeddedAllowDict(AllowGeneral).
+		MustBuild()
+	if embedded.Contains("校园招聘") || !embedded.Contains("高薪招聘") {
+		t.Error("embedded allowlist should only exempt its phrases")
+	}
+
+	// Both loaders parse the list the same way
+	fromFile := NewBuilder().LoadAllowDict("configs/allow/" + AllowGeneral).MustBuild()
+	fromEmbed := NewBuilder().LoadEmbeddedAllowDict(AllowGeneral).MustBuild()
+	if fromFile.allowed == 0 || fromFile.allowed != fromEmbed.allowed {
+		t.Errorf("expected the same allowlist from both loaders, got %d and %d phrases", fromFile.allowed, fromEmbed.allowed)
+	}
+}
+
+func TestWordBoundary(t *testing.T) {
+	tmpFile := t.TempDir() + "/english.txt"
+	if err := os.WriteFile(tmpFile, []byte("ass\nQQ\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	detector := NewBuilder().
+		AddWordWithOptions("sex", LevelMedium, WordOptions{Boundary: BoundaryWord}).
+		AddWordWithOptions("成人sex", LevelHigh, WordOptions{Boundary: BoundaryWord}).
+		LoadDictWithOptions(tmpFile, LevelLow, WordOptions{Boundary: BoundaryWord}).
+		AddWord("spam", LevelLow).
+		MustBuild()
+
+	for _, text := range []string{"sex", "no SEX!", "加QQ号", "Ｑｑ x", "ass.", "看sex视频", "成人sex", "antispam"} {
+		if !detector.Contains(text) {
+			t.Errorf("%q should match", text)
+		}
+	}
+	for _, text := range []string{"Essex", "sextet", "class", "assistant", "QQ2", "sexé", "成人sexy"} {
+		if detector.Contains(text) {
+			t.Errorf("%q should not match", text)
+		}
+	}
+
+	result := detector.Detect("Essex sex 成人sexy")
+	if len(result.Matches) != 1 || result.Matches[0].Start != 6 {
+		t.Errorf("expected only the standalone sex, got %+v", result.Matches)
+	}
+	if m := detector.FindFirst("class ass"); m == nil || m.Start != 6 {
+		t.Errorf("expected the standalone ass, got %+v", m)
+	}
+
+	detector.AddWord("sex", LevelMedium)
+	detector.Build()
+	if !detector.Contains("Essex") {
+		t.Error("AddWord should reset the word options")
+	}
+}
+
+func TestCategories(t *testing.T) {
+	tmpFile := t.TempDir() + "/low_gambling.txt"
+	if err := os.WriteFile(tmpFile, []byte("赌博\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	detector := NewBuilder().
+		WithCategoryStrategy(CategoryViolence, StrategyRemove).
+		LoadEmbeddedDict(DictHighPolitics, LevelHigh).
+		LoadEmbeddedDict(DictHighViolence, LevelHigh).
+		LoadDict(tmpFile).
+		AddWord("hello", LevelLow).
+		MustBuild()
+
+	text := "习近平 炸药 赌博 hello"
+	result := detector.Detect(text)
+	var categories []string
+	for _, m := range result.Matches {
+		categories = append(categories, m.Category)
+	}
+	if !slices.Equal(categories, []string{CategoryPolitics, CategoryViolence, "gambling", ""}) {
+		t.Errorf("unexpected categories %q", categories)
+	}
+	if result.FilteredText != "***  ** *****" {
+		t.Errorf("violence should be removed, got %q", result.FilteredText)
+	}
+	if m := detector.FindFirst("炸药"); m == nil || m.Category != CategoryViolence {
+		t.Errorf("FindFirst should report the category, got %+v", m)
+	}
+
+	only := detector.DetectWithOptions(text, Categories(CategoryPolitics, "gambling"))
+	if len(only.Matches) != 2 || only.FilteredText != "*** 炸药 ** hello" {
+		t.Errorf("expected politics and gambling only, got %+v", only)
+	}
+	except := detector.DetectWithOptions(text, ExcludeCategories(CategoryPolitics))
+	if len(except.Matches) != 3 || except.Matches[0].Category != CategoryViolence {
+		t.Errorf("expected everything but politics, got %+v", except.Matches)
+	}
+	if none := detector.DetectWithOptions(text, Categories()); none.HasSensitive || none.FilteredText != text {
+		t.Errorf("an empty category list should select nothing, got %+v", none)
+	}
+}
+
+func TestMinLevel(t *testing.T) {
+	detector := NewBuilder().
+		AddWord("spam", LevelLow).
+		AddWord("赌博", LevelHigh).
+		AddWord("abcd", LevelLow).
+		AddWord("bc", LevelHigh).
+		AddWord("xyz", LevelHigh).
+		AddWord("y", LevelLow).
+		MustBuild()
+
+	result := detector.DetectWithOptions("spam 赌博", MinLevel(LevelMedium))
+	if len(result.Matches) != 2 || !result.HasSensitive || result.FilteredText != "spam **" {
+		t.Errorf("Low matches should be reported but not filtered, got %+v", result)
+	}
+	result = detector.DetectWithOptions("spam", MinLevel(LevelMedium))
+	if len(result.Matches) != 1 || result.HasSensitive || result.FilteredText != "spam" {
+		t.Errorf("text with only Low matches should not be sensitive, got %+v", result)
+	}
+
+	// A High word found through the fail links of a Low one, and the reverse
+	for _, tt := range []struct {
+		text string
+		want bool
+	}{
+		{"spam", false},
+		{"spam 赌博", true},
+		{"abcd", true},
+		{"xyy", false},
+		{"xy", false},
+	} {
+		if got := detector.ContainsLevel(tt.text, LevelHigh); got != tt.want {
+			t.Errorf("ContainsLevel(%q, LevelHigh) = %v, want %v", tt.text, got, tt.want)
+		}
+		if !detector.ContainsLevel(tt.text, LevelLow) {
+			t.Errorf("ContainsLevel(%q, LevelLow) = false", tt.text)
+		}
+	}
+
+	detector = NewBuilder(WithMinLevel(LevelHigh)).
+		AddWord("spam", LevelLow).
+		AddWord("赌博", LevelHigh).
+		AddAllowWord("赌博游戏").
+		MustBuild()
+	if detector.Contains("spam") || detector.Validate("spam") || detector.FindFirst("spam") != nil {
+		t.Error("Low words should not count with WithMinLevel(LevelHigh)")
+	}
+	if m := detector.FindFirst("spam 赌博"); m == nil || m.Word != "赌博" {
+		t.Errorf("FindFirst() = %+v, want 赌博", m)
+	}
+	if detector.Contains("spam 赌博游戏") {
+		t.Error("allowlisted High words should not count")
+	}
+	if got := detector.Filter("spam 赌博"); got != "spam **" {
+		t.Errorf("Filter() = %q", got)
+	}
+	if got := detector.DetectWithOptions("spam 赌博", MinLevel(LevelLow)).FilteredText; got != "**** **" {
+		t.Errorf("MinLevel should override WithMinLevel, got %q", got)
+	}
+}
+
+func TestCustomLevels(t *testing.T) {
+	const (
+		levelCritical     Level = 10
+		levelBlockAccount Level = 100
+	)
+	if err := RegisterLevel(levelCritical, "Critical"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterLevel(levelBlockAccount, "BlockAccount"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterLevel(levelCritical, "Critical"); err != nil {
+		t.Errorf("registering a level again should be a no-op, got %v", err)
+	}
+	for _, bad := range []struct {
+		level Level
+		name  string
+	}{{LevelHigh, "Severe"}, {5, "critical"}, {0, "None"}, {6, "two words"}, {7, "a_b"}} {
+		if err := RegisterLevel(bad.level, bad.name); err == nil {
+			t.Errorf("RegisterLevel(%d, %q) should fail", bad.level, bad.name)
+		}
+	}
+
+	if !levelBlockAccount.IsValid() || levelBlockAccount.String() != "BlockAccount" || Level(5).IsValid() {
+		t.Error("registered levels should be valid and named")
+	}
+	levels := Levels()
+	if !slices.IsSorted(levels) || !slices.Contains(levels, levelCritical) || levels[0] != LevelLow {
+		t.Errorf("Levels() = %v, want every level in order", levels)
+	}
+	if level, ok := ParseLevel("blockaccount"); !ok || level != levelBlockAccount {
+		t.Errorf("ParseLevel() = %v, %v", level, ok)
+	}
+
+	dir := t.TempDir()
+	os.WriteFile(dir+"/critical_fraud.txt", []byte("诈骗\n封号\tlevel=BlockAccount\n盗号\tlevel=100\n"), 0644)
+	detector := NewBuilder().
+		LoadDict(dir+"/critical_fraud.txt").
+		AddWord("spam", LevelLow).
+		MustBuild()
+
+	result := detector.Detect("spam 诈骗 封号 盗号")
+	want := []Level{LevelLow, levelCritical, levelBlockAccount, levelBlockAccount}
+	if len(result.Matches) != len(want) {
+		t.Fatalf("expected %d matches, got %+v", len(want), result.Matches)
+	}
+	for i, m := range result.Matches {
+		if m.Level != want[i] {
+			t.Errorf("%s: got level %s, want %s", m.Word, m.Level, want[i])
+		}
+	}
+	if result.Matches[1].Category != "fraud" {
+		t.Errorf("the level prefix should be left out of the category, got %q", result.Matches[1].Category)
+	}
+}
+
+func TestConflictPolicy(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{dir + "/low_ad.txt", dir + "/high_politics.txt", dir + "/medium_general.txt"}
+	for _, file := range files {
+		os.WriteFile(file, []byte("网络\n"), 0644)
+	}
+
+	tests := []struct {
+		policy ConflictPolicy
+		levels []Level  // Levels reported for "网络"
+		winner []string // Dictionary of Conflict.Winner, one per conflict
+	}{
+		{ConflictLastWins, []Level{LevelMedium}, []string{files[1], files[2]}},
+		{ConflictFirstWins, []Level{LevelLow}, []string{files[0], files[0]}},
+		{ConflictMaxLevel, []Level{LevelHigh}, []string{files[1], files[1]}},
+		{ConflictKeepAll, []Level{LevelHigh, LevelLow, LevelMedium}, []string{files[1], files[1]}},
+	}
+	for _, tt := range tests {
+		builder := NewBuilder(WithConflictPolicy(tt.policy))
+		for _, file := range files {
+			builder.LoadDict(file)
+		}
+		detector := builder.MustBuild()
+
+		result := detector.Detect("网络")
+		var levels []Level
+		for _, m := range result.Matches {
+			levels = append(levels, m.Level)
+		}
+		if !slices.Equal(levels, tt.levels) {
+			t.Errorf("policy %d: got levels %v, want %v", tt.policy, levels, tt.levels)
+		}
+		if m := detector.FindFirst("网络"); m == nil || m.Level != tt.levels[0] {
+			t.Errorf("policy %d: FindFirst() = %+v", tt.policy, m)
+		}
+
+		// Loading the winning dictionary again is not a conflict
+		detector.LoadDict(tt.winner[len(tt.winner)-1])
+		conflicts := detector.Conflicts()
+		if len(conflicts) != len(tt.winner) {
+			t.Fatalf("policy %d: got conflicts %+v", tt.policy, conflicts)
+		}
+		for i, c := range conflicts {
+			if c.Winner.Source != tt.winner[i] || c.Loser.Source == c.Winner.Source || c.Winner.Word != "网络" {
+				t.Errorf("policy %d: conflict %d = %+v, want winner from %s", tt.policy, i, c, tt.winner[i])
+			}
+		}
+	}
+
+	detector := NewBuilder(WithConflictPolicy(ConflictKeepAll)).
+		LoadDict(files[0]).
+		LoadDict(files[1]).
+		MustBuild()
+	result := detector.DetectWithOptions("网络", Categories(CategoryAd))
+	if len(result.Matches) != 1 || result.Matches[0].Level != LevelLow {
+		t.Errorf("every kept addition should be reported under its own category, got %+v", result.Matches)
+	}
+
+	// Words an option folds together afterwards are resolved by the policy too
+	for policy, levels := range map[ConflictPolicy][]Level{
+		ConflictMaxLevel: {LevelHigh},
+		ConflictKeepAll:  {LevelHigh, LevelLow},
+	} {
+		detector := NewBuilder(WithConflictPolicy(policy), WithCaseSensitive(true)).
+			AddWord("Bad", LevelHigh).
+			AddWord("bad", LevelLow).
+			WithCaseSensitive(false).
+			MustBuild()
+		var got []Level
+		for _, m := range detector.Detect("BAD").Matches {
+			got = append(got, m.Level)
+		}
+		conflicts := detector.Conflicts()
+		if !slices.Equal(got, levels) || len(conflicts) != 1 || conflicts[0].Winner.Word != "Bad" {
+			t.Errorf("policy %d: got levels %v and conflicts %+v, want %v", policy, got, conflicts, levels)
+		}
+	}
+}
+
+func TestLoadPlan(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(dir+"/high_a.txt", []byte("网络\n赌博\n"), 0644)
+	os.WriteFile(dir+"/low_b.txt", []byte("网络\n"), 0644)
+	os.WriteFile(dir+"/medium_c.txt", []byte("网络\tlevel=high\n"), 0644)
+
+	// Priorities, not the order in the plan, decide the load order
+	detector := New()
+	report, err := detector.Load(LoadPlan{
+		{Name: dir + "/high_a.txt", Priority: 2},
+		{Name: dir + "/low_b.txt", Priority: 1},
+		{Name: DictLowURL, Kind: SourceEmbedded, Priority: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.Sources, []string{dir + "/low_b.txt", DictLowURL, dir + "/high_a.txt"}) {
+		t.Errorf("Sources = %v", report.Sources)
+	}
+	if len(report.Duplicates) != 1 {
+		t.Fatalf("Duplicates = %+v", report.Duplicates)
+	}
+	dup := report.Duplicates[0]
+	if dup.Winner.Word != "网络" || dup.Winner.Source != dir+"/high_a.txt" || dup.Winner.Level != LevelHigh ||
+		len(dup.Losers) != 1 || dup.Losers[0].Source != dir+"/low_b.txt" {
+		t.Errorf("Duplicate = %+v", dup)
+	}
+	if _, err := detector.Load(LoadPlan{{Name: dir + "/missing.txt"}}); err == nil {
+		t.Error("a missing dictionary should fail the load")
+	}
+
+	// A word in three files, one group with every loser
+	report, err = New(WithConflictPolicy(ConflictFirstWins)).Load(LoadPlan{
+		{Name: dir + "/low_b.txt"},
+		{Name: dir + "/high_a.txt"},
+		{Name: dir + "/medium_c.txt"},
+	})
+	if err != nil || len(report.Duplicates) != 1 || report.Duplicates[0].Winner.Level != LevelLow || len(report.Duplicates[0].Losers) != 2 {
+		t.Errorf("Load() = %+v, %v", report, err)
+	}
+
+	// Directories rank files by level rather than name
+	words, err := LoadDictDir(dir)
+	if err != nil || words["网络"] != LevelHigh {
+		t.Errorf("LoadDictDir() = %v, %v", words, err)
+	}
+	plan, _ := DirPlan(dir)
+	if len(plan) != 3 || plan[0].Priority != int(LevelHigh) {
+		t.Errorf("DirPlan() = %+v", plan)
+	}
+
+	// The built-in dictionaries load the same way every time, the most
+	// severe one winning
+	for range 3 {
+		detector := NewBuilder().LoadAllEmbedded().MustBuild()
+		if m := detector.FindFirst("习近平"); m == nil || m.Level != LevelHigh || m.Category != CategoryPolitics {
+			t.Fatalf("FindFirst() = %+v", m)
+		}
+	}
+}
+
+func TestMatchMode(t *testing.T) {
+	tests := []struct {
+		mode MatchMode
+		want map[string][]string // Words reported per text
+	}{
+		{MatchAll, map[string][]string{"出售炸药": {"出售", "出售炸药", "炸药"}, "abcd": {"ab", "abc", "bcd"}}},
+		{MatchLeftmostLongest, map[string][]string{"出售炸药": {"出售炸药"}, "abcd": {"abc"}, "出 售 炸 药": {"出售炸药"}}},
+		// "ab" is added after "abc" and still wins, unlike leftmost-first in RE2
+		{MatchLeftmostShortest, map[string][]string{"出售炸药": {"出售", "炸药"}, "abcd": {"ab"}}},
+		{MatchHighestLevel, map[string][]string{"出售炸药": {"出售", "炸药"}, "abcd": {"bcd"}, "ab abc": {"ab", "abc"}}},
+	}
+	for _, tt := range tests {
+		// An allowlist resolves overlaps after the walk rather than during it
+		for _, allow := range []bool{false, true} {
+			builder := NewBuilder(WithMatchMode(tt.mode)).
+				AddWord("出售炸药", LevelLow).
+				AddWord("炸药", LevelHigh).
+				AddWord("出售", LevelMedium).
+				AddWord("abc", LevelLow).
+				AddWord("ab", LevelLow).
+				AddWord("bcd", LevelHigh)
+			if allow {
+				builder.AddAllowWord("无关")
+			}
+			detector := builder.MustBuild()
+
+			for text, want := range tt.want {
+				var got []string
+				for _, m := range detector.Detect(text).Matches {
+					got = append(got, m.Word)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("mode %d, allowlist %v: Detect(%q) = %v, want %v", tt.mode, allow, text, got, want)
+				}
+				// A High word left out by the mode does not count either
+				if got, want := detector.ContainsLevel(text, LevelHigh), slices.Contains(want, "炸药") || slices.Contains(want, "bcd"); got != want {
+					t.Errorf("mode %d, allowlist %v: ContainsLevel(%q, High) = %v, want %v", tt.mode, allow, text, got, want)
+				}
+			}
+			if m := detector.FindFirst("abcd"); m == nil || m.Word != tt.want["abcd"][0] {
+				t.Errorf("mode %d, allowlist %v: FindFirst() = %+v", tt.mode, allow, m)
+			}
+		}
+	}
+
+	detector := NewBuilder(WithMatchMode(MatchLeftmostLongest)).
+		AddWord("出售炸药", LevelHigh).
+		AddWord("炸药", LevelHigh).
+		MustBuild()
+	if result := detector.Detect("出 售 炸 药"); result.Matches[0].Start != 0 || result.Matches[0].End != 7 || result.FilteredText != "*******" {
+		t.Errorf("got %+v", result)
+	}
+}
+
+// cancelAfter, context that reports cancellation once Err has been called
+// a given number of times
+type cancelAfter struct {
+	context.Context
+	calls int // Calls of Err so far
+	after int // Calls answered with nil
+}
+
+func (c *cancelAfter) Err() error {
+	c.calls++
+	if c.calls > c.after {
+		return context.Canceled
+	}
+	return nil
+}
+
+func TestDetectContext(t *testing.T) {
+	detector := NewBuilder(WithMaxInputSize(64)).
+		AddWord("test", LevelHigh).
+		MustBuild()
+
+	result, err := detector.DetectContext(context.Background(), "a test")
+	if err != nil || !result.HasSensitive || result.FilteredText != "a ****" {
+		t.Errorf("DetectContext() = %+v, %v", result, err)
+	}
+
+	_, err = detector.DetectContext(context.Background(), strings.Repeat("a", 65))
+	var tooLarge *InputTooLargeError
+	if !errors.As(err, &tooLarge) || tooLarge.Size != 65 || tooLarge.Limit != 64 {
+		t.Errorf("expected *InputTooLargeError, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := detector.DetectContext(ctx, "a test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// Cancelled during the walk, which stops at its first check
+	detector = NewBuilder().AddWord("test", LevelHigh).MustBuild()
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	counting := &cancelAfter{Context: ctx, after: 1}
+	if _, err := detector.DetectContext(counting, strings.Repeat("a", 100000)+"test"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if counting.calls > 4 {
+		t.Errorf("the walk went on after cancellation, Err called %d times", counting.calls)
+	}
+}
+
+func TestScanReader(t *testing.T) {
+	detector := NewBuilder().
+		AddWord("test", LevelHigh).
+		AddWord("赌博", LevelMedium).
+		AddWord("网络", LevelLow).
+		AddWordWithOptions("sex", LevelMedium, WordOptions{Boundary: BoundaryWord}).
+		AddAllowWord("网络安全").
+		MustBuild()
+
+	// Words straddle the chunk boundaries, some without whitespace around them
+	text := strings.Repeat("a", chunkSize-2) + "test " + strings.Repeat("好", 2000) + "赌博" +
+		strings.Repeat("b", chunkSize) + " Essex sex 网络安全 网络 t.e.s.t at esting"
+	want := detector.Detect(text).Matches
+	for i := range want {
+		want[i].Matched = ""
+	}
+
+	for name, r := range map[string]io.Reader{
+		"whole":    strings.NewReader(text),
+		"one byte": iotest.OneByteReader(strings.NewReader(text)),
+	} {
+		var got []Match
+		err := detector.ScanReader(r, func(m Match) error {
+			got = append(got, m)
+			return nil
+		})
+		if err != nil || !slices.Equal(got, want) {
+			t.Errorf("%s: ScanReader() = %+v, %v, want %+v", name, got, err, want)
+		}
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := detector.ScanReader(strings.NewReader(text), func(Match) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("expected the callback error after one call, got %v after %d", err, calls)
+	}
+
+	scanner := detector.NewScanner(iotest.ErrReader(io.ErrUnexpectedEOF))
+	if scanner.Scan() || scanner.Err() != io.ErrUnexpectedEOF {
+		t.Errorf("expected the read error, got %v", scanner.Err())
+	}
+
+	// Rewrite rules, combining sequences and leetspeak words cut by a read are
+	// normalized as a whole
+	folded := NewBuilder().
+		WithVariant(true).
+		WithNFKC(true).
+		WithLeetFolding(nil).
+		AddVariantRules(map[string]string{"v1agra": "viagra"}).
+		AddWords(map[string]Level{"viagra": LevelHigh, "café": LevelLow, "test": LevelLow}).
+		MustBuild()
+	for _, text := range []string{
+		strings.Repeat("x", 2*chunkSize-6) + "v1agra",
+		strings.Repeat("x", 2*chunkSize-7) + "cafe\u0301",
+		strings.Repeat("x", chunkSize-3) + " 7357" + strings.Repeat("7", chunkSize) + "x",
+	} {
+		want := folded.Detect(text).Matches
+		for i := range want {
+			want[i].Matched = ""
+		}
+		if len(want) == 0 {
+			t.Fatalf("expected Detect to find a match in %q", text[len(text)-12:])
+		}
+		for name, r := range map[string]io.Reader{
+			"whole":    strings.NewReader(text),
+			"one byte": iotest.OneByteReader(strings.NewReader(text)),
+		} {
+			var got []Match
+			err := folded.ScanReader(r, func(m Match) error {
+				got = append(got, m)
+				return nil
+			})
+			if err != nil || !slices.Equal(got, want) {
+				t.Errorf("%s: ScanReader(...%q) = %+v, %v, want %+v", name, text[len(text)-12:], got, err, want)
+			}
+		}
+	}
+
+	// A reader that never returns data nor an error is given up on
+	reader := &emptyReader{}
+	scanner = detector.NewScanner(reader)
+	if scanner.Scan() || scanner.Err() != io.ErrNoProgress || reader.calls != 100 {
+		t.Errorf("expected io.ErrNoProgress after 100 reads, got %v after %d", scanner.Err(), reader.calls)
+	}
+}
+
+// emptyReader, reader whose every Read returns no data and no error
+type emptyReader struct {
+	calls int // Reads so far
+}
+
+func (r *emptyReader) Read([]byte) (int, error) {
+	r.calls++
+	return 0, nil
+}
+
+func TestExtendedDictFormat(t *testing.T) {
+	content := "# attributes follow the word\n" +
+		"plain,\n" +
+		"spam\tlevel=high\tcategory=ad\n" +
+		"sex\tboundary=word\treplace=[censored]\n" +
+		"赌博\tcategory=gambling\tlevel=Low\n"
+	tmpFile := t.TempDir() + "/medium_words.txt"
+	if err := os.WriteFile(tmpFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	detector := NewBuilder().LoadDict(tmpFile).MustBuild()
+
+	result := detector.Detect("plain spam, Essex sex 赌博")
+	want := []struct {
+		word, category string
+		level          Level
+	}{
+		{"plain", "words", LevelMedium},
+		{"spam", "ad", LevelHigh},
+		{"sex", "words", LevelMedium},
+		{"赌博", "gambling", LevelLow},
+	}
+	if len(result.Matches) != len(want) {
+		t.Fatalf("expected %d matches, got %+v", len(want), result.Matches)
+	}
+	for i, w := range want {
+		m := result.Matches[i]
+		if m.Word != w.word || m.Category != w.category || m.Level != w.level {
+			t.Errorf("match %d: got %q %q %v, want %q %q %v", i, m.Word, m.Category, m.Level, w.word, w.category, w.level)
+		}
+	}
+	if result.FilteredText != "***** ****, Essex [censored] **" {
+		t.Errorf("unexpected filtered text %q", result.FilteredText)
+	}
+
+	invalid := []struct {
+		content string
+		line    int
+	}{
+		{"ok\nbad\tlevel=extreme\n", 2},
+		{"# c\n\nbad\tcolor=red\n", 3},
+		{"bad\tboundary=line\n", 1},
+		{"bad\treplace=\n", 1},
+		{"bad\tlevel=high\tlevel=low\n", 1},
+		{"bad\thigh\n", 1},
+		{"\tlevel=high\n", 1},
+	}
+	for _, tt := range invalid {
+		path := t.TempDir() + "/invalid.txt"
+		os.WriteFile(path, []byte(tt.content), 0644)
+		err := New().LoadDict(path)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.Line != tt.line || parseErr.Source != path {
+			t.Errorf("%q: expected a ParseError on line %d, got %v", tt.content, tt.line, err)
+		}
+	}
 }
 
 func TestLoadDictFromURL(t *testing.T) {
@@ -5,67 +5,160 @@ package sensitive
 
 import (
 	"embed"
-	"errors"
-	"strings"
+	"maps"
+	"sync"
+
+	"github.com/Done-0/sensitive/internal/normalizer"
 )
 
-//go:embed configs/dict/*.txt
+//go:embed configs/dict/*.txt configs/variant/*.txt configs/unicode/*.txt configs/pinyin/*.txt configs/split/*.txt configs/allow/*.txt
 var dictFS embed.FS
 
 const (
-	DictHighPolitics     = "high_politics.txt"
-	DictHighPornography  = "high_pornography.txt"
-	DictHighViolence     = "high_violence.txt"
-	DictMediumGeneral    = "medium_general.txt"
-	DictLowAd            = "low_ad.txt"
-	DictLowURL           = "low_url.txt"
+	DictHighPolitics    = "high_politics.txt"
+	DictHighPornography = "high_pornography.txt"
+	DictHighViolence    = "high_violence.txt"
+	DictMediumGeneral   = "medium_general.txt"
+	DictLowAd           = "low_ad.txt"
+	DictLowURL          = "low_url.txt"
 )
 
-func LoadAllEmbedded(detector *Detector) error {
-	dicts := map[string]Level{
-		DictHighPolitics:    LevelHigh,
-		DictHighPornography: LevelHigh,
-		DictHighViolence:    LevelHigh,
-		DictMediumGeneral:   LevelMedium,
-		DictLowAd:           LevelLow,
-		DictLowURL:          LevelLow,
-	}
+// Categories of the built-in dictionaries, reported on Match
+const (
+	CategoryPolitics    = "politics"
+	CategoryPornography = "pornography"
+	CategoryViolence    = "violence"
+	CategoryGeneral     = "general"
+	CategoryAd          = "ad"
+	CategoryURL         = "url"
+)
 
-	for name, level := range dicts {
-		if err := LoadEmbeddedDict(detector, name, level); err != nil {
-			return err
+const (
+	AllowGeneral = "general.txt"
+)
+
+const (
+	VariantTraditional = "t2s.txt"
+	VariantWidth       = "width.txt"
+)
+
+// embeddedVariants is the merged built-in variant map used when variant
+// detection is enabled without loading a map explicitly
+var embeddedVariants = sync.OnceValue(func() map[string]string {
+	variants := make(map[string]string, 1024)
+	for _, name := range []string{VariantTraditional, VariantWidth} {
+		file, err := dictFS.Open("configs/variant/" + name)
+		if err != nil {
+			continue
+		}
+		table, err := normalizer.ParseVariantMap(file)
+		file.Close()
+		if err == nil {
+			maps.Copy(variants, table)
 		}
 	}
+	return variants
+})
 
-	return nil
+// embeddedConfusables is the TR39 skeleton table used by confusable folding
+var embeddedConfusables = sync.OnceValue(func() map[rune]string {
+	file, err := dictFS.Open("configs/unicode/confusables.txt")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	table, _ := normalizer.ParseCharTable(file)
+	return table
+})
+
+// embeddedPinyin maps Hanzi to their toneless pinyin for pinyin matching
+var embeddedPinyin = sync.OnceValue(func() map[rune]string {
+	file, err := dictFS.Open("configs/pinyin/pinyin.txt")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	table, _ := normalizer.ParseCharTable(file)
+	return table
+})
+
+// embeddedComponents maps left and right component pairs to the Hanzi they
+// form, for split character matching
+var embeddedComponents = sync.OnceValue(func() map[string]string {
+	file, err := dictFS.Open("configs/split/components.txt")
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	table, _ := normalizer.ParseVariantMap(file)
+	return table
+})
+
+// LoadAllEmbedded loads every built-in dictionary, see EmbeddedPlan
+func LoadAllEmbedded(detector *Detector) error {
+	_, err := detector.Load(EmbeddedPlan())
+	return err
 }
 
-func LoadEmbeddedDict(detector *Detector, name string, level Level) error {
-	if !level.IsValid() {
-		return errors.New("invalid level")
+// EmbeddedPlan returns the plan of every built-in dictionary, each with its
+// level as priority so the most severe dictionary wins a duplicated word.
+// Custom sources can be appended to it
+func EmbeddedPlan() LoadPlan {
+	return LoadPlan{
+		{Name: DictLowAd, Kind: SourceEmbedded, Level: LevelLow, Priority: int(LevelLow)},
+		{Name: DictLowURL, Kind: SourceEmbedded, Level: LevelLow, Priority: int(LevelLow)},
+		{Name: DictMediumGeneral, Kind: SourceEmbedded, Level: LevelMedium, Priority: int(LevelMedium)},
+		{Name: DictHighPolitics, Kind: SourceEmbedded, Level: LevelHigh, Priority: int(LevelHigh)},
+		{Name: DictHighPornography, Kind: SourceEmbedded, Level: LevelHigh, Priority: int(LevelHigh)},
+		{Name: DictHighViolence, Kind: SourceEmbedded, Level: LevelHigh, Priority: int(LevelHigh)},
 	}
+}
+
+func LoadEmbeddedDict(detector *Detector, name string, level Level) error {
+	return LoadEmbeddedDictWithOptions(detector, name, level, WordOptions{})
+}
 
-	data, err := dictFS.ReadFile("configs/dict/" + name)
+// LoadEmbeddedDictWithOptions loads a built-in dictionary and gives every word
+// the attributes in opts, such as BoundaryWord so its English terms only
+// match whole words. An empty category is named after the dictionary, such
+// as CategoryPolitics for DictHighPolitics
+func LoadEmbeddedDictWithOptions(detector *Detector, name string, level Level, opts WordOptions) error {
+	entries, err := sourceEntries(DictSource{Name: name, Kind: SourceEmbedded, Options: opts}, level)
 	if err != nil {
 		return err
 	}
+	return detector.addEntries(entries, nil)
+}
 
-	words := make([]string, 0, 512)
-	for line := range strings.SplitSeq(string(data), "\n") {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		line = strings.TrimSuffix(line, ",")
-		if line != "" {
-			words = append(words, line)
-		}
+func loadEmbedded(dir, name string, level Level, opts WordOptions) ([]dictEntry, error) {
+	file, err := dictFS.Open("configs/" + dir + "/" + name)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	wordMap := make(map[string]Level, len(words))
-	for _, word := range words {
-		wordMap[word] = level
+	return parseDict(file, name, level, opts)
+}
+
+// LoadEmbeddedAllowDict allowlists the phrases of a built-in allowlist, such
+// as AllowGeneral
+func LoadEmbeddedAllowDict(detector *Detector, name string) error {
+	entries, err := loadEmbedded("allow", name, LevelMedium, WordOptions{})
+	if err != nil {
+		return err
 	}
+	return detector.addAllowEntries(entries)
+}
+
+func LoadAllEmbeddedVariants(detector *Detector) error {
+	for _, name := range []string{VariantTraditional, VariantWidth} {
+		if err := LoadEmbeddedVariantMap(detector, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	return detector.AddWords(wordMap)
+func LoadEmbeddedVariantMap(detector *Detector, name string) error {
+	return detector.LoadVariantMapFS(dictFS, "configs/variant/"+name)
 }
@@ -0,0 +1,103 @@
+//go:build ignore
+
+// Package main generates nfkc_tables.go from golang.org/x/text/unicode/norm.
+// The tables must come from the Unicode version of the confusables table in
+// configs/unicode, the one UnicodeVersion records, or generation fails.
+//
+// Usage, from this directory, with Go 1.27 or later and golang.org/x/text
+// v0.37.0 or later, whose tables are Unicode 17.0.0:
+//
+//	go run -mod=mod gen_nfkc.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusablesVersion matches the Unicode version in the header of the
+// confusables table
+var confusablesVersion = regexp.MustCompile(`(?m)^# Source: .*, Unicode (\d+\.\d+\.\d+),`)
+
+func main() {
+	header, err := os.ReadFile("../../configs/unicode/confusables.txt")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if m := confusablesVersion.FindSubmatch(header); m == nil || string(m[1]) != norm.Version {
+		fmt.Fprintf(os.Stderr, "norm tables are Unicode %s, confusables.txt is not\n", norm.Version)
+		os.Exit(1)
+	}
+
+	var decomp, classes bytes.Buffer
+	var pairs [][3]rune
+	for r := rune(0); r <= utf8.MaxRune; r++ {
+		// Surrogates are not characters and Hangul syllables are composed
+		// algorithmically
+		if r >= 0xD800 && r <= 0xDFFF || r >= 0xAC00 && r <= 0xD7A3 {
+			continue
+		}
+		s := string(r)
+		if d := norm.NFKD.String(s); d != s {
+			fmt.Fprintf(&decomp, "\t{0x%04X, %s},\n", r, strconv.QuoteToASCII(d))
+		}
+		if ccc := norm.NFD.PropertiesString(s).CCC(); ccc != 0 {
+			fmt.Fprintf(&classes, "\t{0x%04X, %d},\n", r, ccc)
+		}
+
+		// Primary composites, the pair is the last mark and the rest composed
+		d := []rune(string(norm.NFD.PropertiesString(s).Decomposition()))
+		if len(d) < 2 {
+			continue
+		}
+		first := []rune(norm.NFC.String(string(d[:len(d)-1])))
+		last := d[len(d)-1]
+		if len(first) == 1 && norm.NFC.String(string(first[0])+string(last)) == s {
+			pairs = append(pairs, [3]rune{first[0], last, r})
+		}
+	}
+	slices.SortFunc(pairs, func(a, b [3]rune) int {
+		if a[0] != b[0] {
+			return int(a[0] - b[0])
+		}
+		return int(a[1] - b[1])
+	})
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by gen_nfkc.go from Unicode %s; DO NOT EDIT.\n\n", norm.Version)
+	out.WriteString("package normalizer\n\n")
+	out.WriteString("// UnicodeVersion is the Unicode version of the NFKC tables and of the\n")
+	out.WriteString("// confusables table\n")
+	fmt.Fprintf(&out, "const UnicodeVersion = %q\n\n", norm.Version)
+	out.WriteString("// nfkcDecomp holds the full compatibility decomposition of every character\n")
+	out.WriteString("// that has one, sorted by character\n")
+	fmt.Fprintf(&out, "var nfkcDecomp = [...]decomposition{\n%s}\n\n", decomp.Bytes())
+	out.WriteString("// combiningClass holds the non-zero canonical combining classes\n")
+	fmt.Fprintf(&out, "var combiningClass = [...]combiningEntry{\n%s}\n\n", classes.Bytes())
+	out.WriteString("// compositions maps the canonical pair of every primary composite to the\n")
+	out.WriteString("// composite, sorted by starter then mark\n")
+	out.WriteString("var compositions = [...]composition{\n")
+	for _, p := range pairs {
+		fmt.Fprintf(&out, "\t{0x%04X, 0x%04X, 0x%04X},\n", p[0], p[1], p[2])
+	}
+	out.WriteString("}\n")
+
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile("nfkc_tables.go", src, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
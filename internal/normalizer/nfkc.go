@@ -0,0 +1,171 @@
+// Package normalizer provides text normalization for sensitive word detection
+// Creator: Done-0
+// Created: 2026-10-16
+package normalizer
+
+import (
+	"cmp"
+	"slices"
+	"unicode"
+)
+
+const (
+	hangulBase  = 0xAC00
+	hangulL     = 0x1100
+	hangulV     = 0x1161
+	hangulT     = 0x11A7
+	hangulLen   = 19
+	hangulVLen  = 21
+	hangulTLen  = 28
+	hangulCount = hangulLen * hangulVLen * hangulTLen
+)
+
+// decomposition, compatibility decomposition of a character
+type decomposition struct {
+	r  rune   // Decomposed character
+	to string // Full NFKD form
+}
+
+// combiningEntry, canonical combining class of a character
+type combiningEntry struct {
+	r   rune  // Combining character
+	ccc uint8 // Canonical combining class
+}
+
+// composition, canonical pair of a primary composite
+type composition struct {
+	starter   rune // First character of the pair
+	mark      rune // Second character of the pair
+	composite rune // Character the pair composes to
+}
+
+// nfkc normalizes in to NFKC, appending to out, then drops invisible
+// characters and the combining marks that did not compose. Every rune keeps
+// the span of the characters it was built from
+func nfkc(in, out *seq) {
+	out.reset()
+	for i, r := range in.runes {
+		if to := decompose(r); to != "" {
+			for _, d := range to {
+				out.push(d, in.starts[i], in.ends[i])
+			}
+			continue
+		}
+		out.push(r, in.starts[i], in.ends[i])
+	}
+	reorder(out)
+	compose(out)
+	strip(out)
+}
+
+// reorder sorts every run of combining marks by combining class
+func reorder(s *seq) {
+	for i := 1; i < len(s.runes); i++ {
+		cc := combining(s.runes[i])
+		if cc == 0 {
+			continue
+		}
+		for j := i; j > 0; j-- {
+			if prev := combining(s.runes[j-1]); prev <= cc {
+				break
+			}
+			s.runes[j], s.runes[j-1] = s.runes[j-1], s.runes[j]
+			s.starts[j], s.starts[j-1] = s.starts[j-1], s.starts[j]
+			s.ends[j], s.ends[j-1] = s.ends[j-1], s.ends[j]
+		}
+	}
+}
+
+// compose applies canonical composition in place, a composite spans every
+// character it absorbed
+func compose(s *seq) {
+	starter, last, n := -1, uint8(0), 0
+	for i, r := range s.runes {
+		cc := combining(r)
+		if starter >= 0 && (n-1 == starter || last != 0 && last < cc) {
+			if c, ok := composite(s.runes[starter], r); ok {
+				s.runes[starter] = c
+				s.starts[starter] = min(s.starts[starter], s.starts[i])
+				s.ends[starter] = max(s.ends[starter], s.ends[i])
+				continue
+			}
+		}
+		if cc == 0 {
+			starter = n
+		}
+		last = cc
+		s.runes[n], s.starts[n], s.ends[n] = r, s.starts[i], s.ends[i]
+		n++
+	}
+	s.runes, s.starts, s.ends = s.runes[:n], s.starts[:n], s.ends[:n]
+}
+
+// strip drops invisible characters and leftover combining marks in place
+func strip(s *seq) {
+	n := 0
+	for i, r := range s.runes {
+		if isInvisible(r) || r >= 0x300 && unicode.In(r, unicode.Mn, unicode.Me) {
+			continue
+		}
+		s.runes[n], s.starts[n], s.ends[n] = r, s.starts[i], s.ends[i]
+		n++
+	}
+	s.runes, s.starts, s.ends = s.runes[:n], s.starts[:n], s.ends[:n]
+}
+
+// isInvisible reports whether r renders as nothing, such as zero width
+// spaces and joiners, the byte order mark, variation selectors and Hangul
+// fillers
+func isInvisible(r rune) bool {
+	switch r {
+	case 0x034F, 0x115F, 0x1160, 0x17B4, 0x17B5, 0x3164, 0xFFA0:
+		return true
+	}
+	return r >= 0x80 && (unicode.Is(unicode.Cf, r) || unicode.Is(unicode.Variation_Selector, r))
+}
+
+func decompose(r rune) string {
+	if r < 0xA0 || r >= hangulBase && r < hangulBase+hangulCount {
+		return ""
+	}
+	if i, ok := slices.BinarySearchFunc(nfkcDecomp[:], r, func(e decomposition, r rune) int {
+		return cmp.Compare(e.r, r)
+	}); ok {
+		return nfkcDecomp[i].to
+	}
+	return ""
+}
+
+func combining(r rune) uint8 {
+	if r < 0x300 {
+		return 0
+	}
+	if i, ok := slices.BinarySearchFunc(combiningClass[:], r, func(e combiningEntry, r rune) int {
+		return cmp.Compare(e.r, r)
+	}); ok {
+		return combiningClass[i].ccc
+	}
+	return 0
+}
+
+func composite(starter, mark rune) (rune, bool) {
+	// Hangul syllables are composed algorithmically, L+V then LV+T
+	if l := starter - hangulL; l >= 0 && l < hangulLen {
+		if v := mark - hangulV; v >= 0 && v < hangulVLen {
+			return hangulBase + (l*hangulVLen+v)*hangulTLen, true
+		}
+	}
+	if s := starter - hangulBase; s >= 0 && s < hangulCount && s%hangulTLen == 0 {
+		if t := mark - hangulT; t > 0 && t < hangulTLen {
+			return starter + t, true
+		}
+	}
+
+	i, ok := slices.BinarySearchFunc(compositions[:], [2]rune{starter, mark}, func(e composition, key [2]rune) int {
+		return cmp.Or(cmp.Compare(e.starter, key[0]), cmp.Compare(e.mark, key[1]))
+	})
+	if !ok {
+		return 0, false
+	}
+	return compositions[i].composite, true
+}
@@ -5,104 +5,569 @@ package normalizer
 
 import (
 	"bufio"
-	"os"
+	"io"
+	"maps"
+	"slices"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-var variantMap map[rune]rune
+// maxSegment is the most characters a starter and the combining marks after
+// it hold in stream-safe text, UAX #15
+const maxSegment = 31
 
+// Normalizer folds text before matching. It is not safe for concurrent
+// mutation, callers clone it and treat the clone as read-only once shared
 type Normalizer struct {
-	variant bool
-	lower   bool
+	variant     bool
+	lower       bool
+	nfkc        bool              // Apply NFKC and strip invisible characters before folding
+	variants    map[string]string // Variant rules as loaded, source → replacement
+	confusables map[rune]string   // Confusable table as loaded, nil when skeleton folding is off
+	leetTable   map[rune]rune     // Leetspeak table as loaded, nil when leet folding is off
+	leetASCII   bool              // Fold leetspeak only inside ASCII words
+	single      map[rune]rune     // Compiled one-to-one rules
+	multi       map[rune][]rule   // Compiled rules keyed by first rune, longest source first
+	longest     int               // Runes in the longest compiled rule source
+	skeleton    map[rune][]rune   // Compiled confusable skeletons
+	leet        map[rune]rune     // Compiled leetspeak table
+}
+
+// rule, compiled variant rule rewriting a rune sequence
+type rule struct {
+	from []rune // Folded source sequence
+	to   []rune // Folded replacement
+}
+
+// Text, normalized text that remembers where every rune came from
+type Text struct {
+	Runes   []rune // Normalized runes
+	Starts  []int  // Source rune index where each normalized rune begins
+	Ends    []int  // Source rune index where each normalized rune ends
+	Offsets []int  // Byte offset of every source rune, followed by the source length
+	stages  [2]seq
+}
+
+// seq, runes handed from one normalization stage to the next
+type seq struct {
+	runes  []rune // Runes produced by the stage
+	starts []int  // Source rune index where each rune begins
+	ends   []int  // Source rune index where each rune ends
+}
+
+func (s *seq) reset() {
+	s.runes, s.starts, s.ends = s.runes[:0], s.starts[:0], s.ends[:0]
+}
+
+func (s *seq) push(r rune, start, end int) {
+	s.runes = append(s.runes, r)
+	s.starts = append(s.starts, start)
+	s.ends = append(s.ends, end)
 }
 
 func New(variant, caseSensitive bool) *Normalizer {
 	return &Normalizer{variant: variant, lower: !caseSensitive}
 }
 
+func (n *Normalizer) Clone() *Normalizer {
+	clone := *n
+	return &clone
+}
+
+func (n *Normalizer) Configure(variant, caseSensitive bool) {
+	n.variant = variant
+	n.lower = !caseSensitive
+	n.compile()
+}
+
+// SetConfusables folds every character of table to its prototype before the
+// variant rules run, nil turns skeleton folding off. The table is not copied
+// and must not be modified afterwards
+func (n *Normalizer) SetConfusables(table map[rune]string) {
+	n.confusables = table
+	n.compile()
+}
+
+// SetNFKC applies NFKC normalization first and strips invisible characters
+// and combining marks that do not compose, such as U+200B or "b\u0338ad"
+func (n *Normalizer) SetNFKC(enable bool) {
+	n.nfkc = enable
+	n.compile()
+}
+
+// SetLeet folds leetspeak such as "$pam" or "b4d" with table, nil turns leet
+// folding off. With asciiOnly a character is only folded inside a run of ASCII
+// letters, digits and table characters that holds at least one letter, so
+// digits in CJK text or plain numbers are kept
+func (n *Normalizer) SetLeet(table map[rune]rune, asciiOnly bool) {
+	n.leetTable = table
+	n.leetASCII = asciiOnly
+	n.compile()
+}
+
 func (n *Normalizer) Normalize(text string) string {
-	runes := []rune(text)
-	for i, r := range runes {
-		if n.variant && variantMap != nil {
-			if s, ok := variantMap[r]; ok {
-				r = s
+	return string(n.ToRunes(text, nil))
+}
+
+func (n *Normalizer) ToRunes(text string, buf []rune) []rune {
+	if !n.InPlace() {
+		return n.slowRunes(text, buf)
+	}
+	buf = n.fold(text, buf)
+	n.leetify(buf)
+	if n.rewrites() {
+		for i, r := range buf {
+			if s, ok := n.single[r]; ok {
+				buf[i] = s
 			}
 		}
-		if n.lower {
+	}
+	return buf
+}
+
+// InPlace reports whether normalization maps every rune to one rune, so
+// ToRunes needs no buffer besides buf. Otherwise ToText with a reused Text
+// normalizes without allocating
+func (n *Normalizer) InPlace() bool {
+	return !n.nfkc && n.skeleton == nil && (!n.rewrites() || len(n.multi) == 0)
+}
+
+// fold applies case and width folding, which never changes the rune count
+func (n *Normalizer) fold(text string, buf []rune) []rune {
+	buf = buf[:0]
+	for _, r := range text {
+		buf = append(buf, n.foldRune(r))
+	}
+	return buf
+}
+
+func (n *Normalizer) foldRune(r rune) rune {
+	if n.lower {
+		if r >= 'A' && r <= 'Z' {
+			r += 32
+		} else if r > 127 {
 			r = unicode.ToLower(r)
 		}
-		if r >= 0xFF01 && r <= 0xFF5E {
-			r -= 0xFEE0
-		} else if r == 0x3000 {
-			r = ' '
+	}
+	if r >= 0xFF01 && r <= 0xFF5E {
+		r -= 0xFEE0
+	} else if r == 0x3000 {
+		r = ' '
+	}
+	return r
+}
+
+// slowRunes runs the full pipeline for stages that change the rune count
+func (n *Normalizer) slowRunes(text string, buf []rune) []rune {
+	var t Text
+	n.ToText(text, &t)
+	return append(buf[:0], t.Runes...)
+}
+
+// ToText normalizes text into t like ToRunes, and records the source span of
+// every normalized rune so matches can be mapped back to the input
+func (n *Normalizer) ToText(text string, t *Text) {
+	t.Offsets = t.Offsets[:0]
+	for i := range text {
+		t.Offsets = append(t.Offsets, i)
+	}
+	t.Offsets = append(t.Offsets, len(text))
+
+	cur := n.stage(text, t)
+	if n.rewrites() {
+		next := &t.stages[0]
+		if cur == next {
+			next = &t.stages[1]
 		}
-		runes[i] = r
+		n.rewrite(cur, next)
+		cur = next
 	}
-	return string(runes)
+	t.Runes, t.Starts, t.Ends = cur.runes, cur.starts, cur.ends
 }
 
-func (n *Normalizer) ToRunes(text string, buf []rune) []rune {
-	buf = buf[:0]
-	if !n.variant && !n.lower {
+// stage runs every stage in front of the variant rules on text, using t for
+// scratch space, and returns the stage holding the result
+func (n *Normalizer) stage(text string, t *Text) *seq {
+	cur, next := &t.stages[0], &t.stages[1]
+	if n.nfkc {
+		// Folding waits for NFKC, which needs the characters as written
+		cur.runes = cur.runes[:0]
 		for _, r := range text {
-			if r >= 0xFF01 && r <= 0xFF5E {
-				r -= 0xFEE0
-			} else if r == 0x3000 {
-				r = ' '
+			cur.runes = append(cur.runes, r)
+		}
+	} else {
+		cur.runes = n.fold(text, cur.runes)
+	}
+	cur.starts, cur.ends = cur.starts[:0], cur.ends[:0]
+	for i := range cur.runes {
+		cur.starts = append(cur.starts, i)
+		cur.ends = append(cur.ends, i+1)
+	}
+	if n.nfkc {
+		nfkc(cur, next)
+		cur, next = next, cur
+		for i, r := range cur.runes {
+			cur.runes[i] = n.foldRune(r)
+		}
+	}
+	n.leetify(cur.runes)
+	if n.skeleton != nil {
+		n.confuse(cur, next)
+		cur = next
+	}
+	return cur
+}
+
+// Settled returns how many leading source runes of text normalize the same
+// whatever follows text, t being text normalized by ToText. Such a prefix ends
+// where no normalized rune, variant rule, combining sequence or leetspeak word
+// runs on, and leaves the runes a rule or a combining sequence may still reach
+// after it. When no such prefix is found, it returns all but those runes and
+// false
+func (n *Normalizer) Settled(text string, t *Text) (int, bool) {
+	reach := 1
+	if n.rewrites() {
+		reach = max(reach, n.longest)
+	}
+	if n.nfkc {
+		// Every rune a rule reads may be composed from a whole segment
+		reach *= maxSegment
+	}
+	limit := max(len(t.Offsets)-1-reach, 1)
+	for k := len(t.Runes) - 1; k > 0; k-- {
+		start := t.Starts[k]
+		if start > limit || t.Ends[k-1] > start {
+			continue
+		}
+		if n.nfkc && !isStarter(text[t.Offsets[start]:]) {
+			continue
+		}
+		if n.leetASCII && len(n.leet) > 0 {
+			if r, _ := utf8.DecodeLastRuneInString(text[:t.Offsets[start]]); !n.breaksLeet(r) {
+				continue
 			}
-			buf = append(buf, r)
 		}
-		return buf
+		return start, true
 	}
-	if n.lower && !n.variant {
-		for _, r := range text {
-			if r >= 'A' && r <= 'Z' {
-				r += 32
-			} else if r > 127 {
-				r = unicode.ToLower(r)
+	return limit, false
+}
+
+// isStarter reports whether the first character of text begins a combining
+// sequence, so NFKC never joins it to the characters before it
+func isStarter(text string) bool {
+	r, _ := utf8.DecodeRuneInString(text)
+	if to := decompose(r); to != "" {
+		r, _ = utf8.DecodeRuneInString(to)
+	}
+	return combining(r) == 0
+}
+
+// breaksLeet reports whether r ends any run leetspeak folding treats as one
+// word, see SetLeet
+func (n *Normalizer) breaksLeet(r rune) bool {
+	if r < utf8.RuneSelf {
+		return !n.leetWord(n.foldRune(r))
+	}
+	return !slices.ContainsFunc(n.prepare(string(r)), n.leetWord)
+}
+
+// Span maps the normalized runes [start, end) back to the rune and byte
+// offsets they cover in the source
+func (t *Text) Span(start, end int) (runeStart, runeEnd, byteStart, byteEnd int) {
+	runeStart, runeEnd = t.Starts[start], t.Ends[end-1]
+	return runeStart, runeEnd, t.Offsets[runeStart], t.Offsets[runeEnd]
+}
+
+// Transliterate writes t to out with every rune found in table spelled out,
+// such as Hanzi by their pinyin. The spans are kept, so out maps back to the
+// same source
+func (t *Text) Transliterate(table map[rune]string, out *Text) {
+	out.Runes, out.Starts, out.Ends = out.Runes[:0], out.Starts[:0], out.Ends[:0]
+	out.Offsets = append(out.Offsets[:0], t.Offsets...)
+	for i, r := range t.Runes {
+		if spelled, ok := table[r]; ok {
+			for _, s := range spelled {
+				out.Runes = append(out.Runes, s)
+				out.Starts = append(out.Starts, t.Starts[i])
+				out.Ends = append(out.Ends, t.Ends[i])
 			}
-			if r >= 0xFF01 && r <= 0xFF5E {
-				r -= 0xFEE0
-			} else if r == 0x3000 {
-				r = ' '
+			continue
+		}
+		out.Runes = append(out.Runes, r)
+		out.Starts = append(out.Starts, t.Starts[i])
+		out.Ends = append(out.Ends, t.Ends[i])
+	}
+}
+
+// Compose writes t to out with every adjacent pair found in pairs joined into
+// one rune, such as "弓虽" into "强", pairing from the left. A joined rune spans
+// both components, it reports whether any pair was joined
+func (t *Text) Compose(pairs map[[2]rune]rune, out *Text) bool {
+	out.Runes, out.Starts, out.Ends = out.Runes[:0], out.Starts[:0], out.Ends[:0]
+	out.Offsets = append(out.Offsets[:0], t.Offsets...)
+	joined := false
+	for i := 0; i < len(t.Runes); i++ {
+		if i+1 < len(t.Runes) {
+			if r, ok := pairs[[2]rune{t.Runes[i], t.Runes[i+1]}]; ok {
+				out.Runes = append(out.Runes, r)
+				out.Starts = append(out.Starts, t.Starts[i])
+				out.Ends = append(out.Ends, t.Ends[i+1])
+				joined = true
+				i++
+				continue
 			}
-			buf = append(buf, r)
 		}
-		return buf
+		out.Runes = append(out.Runes, t.Runes[i])
+		out.Starts = append(out.Starts, t.Starts[i])
+		out.Ends = append(out.Ends, t.Ends[i])
 	}
-	for _, r := range text {
-		if variantMap != nil {
-			if s, ok := variantMap[r]; ok {
-				r = s
+	return joined
+}
+
+// Expands reports whether a character may be normalized to several runes, as
+// by confusable skeletons such as "m" → "rn", NFKC or variant rules such as
+// "㎏" → "kg"
+func (n *Normalizer) Expands() bool {
+	return n.skeleton != nil || n.nfkc || n.rewrites() && len(n.multi) > 0
+}
+
+func (n *Normalizer) rewrites() bool {
+	return n.variant && (len(n.single) > 0 || len(n.multi) > 0)
+}
+
+// leetify folds leetspeak in place, it never changes the rune count
+func (n *Normalizer) leetify(runes []rune) {
+	if len(n.leet) == 0 {
+		return
+	}
+	if !n.leetASCII {
+		for i, r := range runes {
+			if to, ok := n.leet[r]; ok {
+				runes[i] = to
 			}
 		}
-		if n.lower {
-			if r >= 'A' && r <= 'Z' {
-				r += 32
-			} else if r > 127 {
-				r = unicode.ToLower(r)
+		return
+	}
+
+	for start := 0; start < len(runes); {
+		if !n.leetWord(runes[start]) {
+			start++
+			continue
+		}
+		end, letter := start, false
+		for ; end < len(runes) && n.leetWord(runes[end]); end++ {
+			if r := runes[end]; (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') && !n.isLeet(r) {
+				letter = true
 			}
 		}
-		if r >= 0xFF01 && r <= 0xFF5E {
-			r -= 0xFEE0
-		} else if r == 0x3000 {
-			r = ' '
+		if letter {
+			for i := start; i < end; i++ {
+				if to, ok := n.leet[runes[i]]; ok {
+					runes[i] = to
+				}
+			}
 		}
-		buf = append(buf, r)
+		start = end
 	}
-	return buf
 }
 
-func LoadVariantMap(path string) error {
-	f, err := os.Open(path)
+// leetWord reports whether r can be part of an ASCII word written in leetspeak
+func (n *Normalizer) leetWord(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || n.isLeet(r)
+}
+
+func (n *Normalizer) isLeet(r rune) bool {
+	_, ok := n.leet[r]
+	return ok
+}
+
+// confuse replaces every confusable in in with its skeleton, each skeleton
+// rune keeps the span of the character it replaces
+func (n *Normalizer) confuse(in, out *seq) {
+	out.reset()
+	for i, r := range in.runes {
+		if to, ok := n.skeleton[r]; ok {
+			for _, s := range to {
+				out.push(s, in.starts[i], in.ends[i])
+			}
+			continue
+		}
+		out.push(r, in.starts[i], in.ends[i])
+	}
+}
+
+// rewrite applies the variant rules to in, longest source first
+func (n *Normalizer) rewrite(in, out *seq) {
+	out.reset()
+	text := in.runes
+	for i := 0; i < len(text); {
+		r := text[i]
+		if rules, ok := n.multi[r]; ok {
+			if rl := matchRule(rules, text[i:]); rl != nil {
+				end := i + len(rl.from)
+				for _, s := range rl.to {
+					out.push(s, in.starts[i], in.ends[end-1])
+				}
+				i = end
+				continue
+			}
+		}
+		if s, ok := n.single[r]; ok {
+			r = s
+		}
+		out.push(r, in.starts[i], in.ends[i])
+		i++
+	}
+}
+
+func matchRule(rules []rule, text []rune) *rule {
+	for i := range rules {
+		if len(rules[i].from) <= len(text) && slices.Equal(rules[i].from, text[:len(rules[i].from)]) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// AddVariants merges variant rules into the variant table, later entries
+// override earlier ones. Both sides may span several characters, such as
+// "㎏" → "kg" or "v1agra" → "viagra". The table is copied so clones sharing
+// it are unaffected
+func (n *Normalizer) AddVariants(variants map[string]string) {
+	merged := make(map[string]string, len(n.variants)+len(variants))
+	maps.Copy(merged, n.variants)
+	for from, to := range variants {
+		if from != "" {
+			merged[from] = to
+		}
+	}
+	n.variants = merged
+	n.compile()
+}
+
+// compile folds the confusable table and the variant rules the same way input
+// text is folded, so they can be matched against folded text
+func (n *Normalizer) compile() {
+	n.single, n.multi, n.skeleton, n.leet, n.longest = nil, nil, nil, nil, 0
+	n.compileLeet()
+	n.compileSkeleton()
+	if len(n.variants) == 0 {
+		return
+	}
+
+	single := make(map[rune]rune, len(n.variants))
+	multi := make(map[rune][]rule)
+	for from, to := range n.variants {
+		f := n.prepare(from)
+		if len(f) == 0 {
+			// Nothing is left to rewrite once NFKC strips an invisible source
+			continue
+		}
+		t := n.prepare(to)
+		if len(f) == 1 && len(t) == 1 {
+			single[f[0]] = t[0]
+			continue
+		}
+		multi[f[0]] = append(multi[f[0]], rule{from: f, to: t})
+		n.longest = max(n.longest, len(f))
+	}
+	for _, rules := range multi {
+		slices.SortFunc(rules, func(a, b rule) int {
+			if len(a.from) != len(b.from) {
+				return len(b.from) - len(a.from)
+			}
+			return slices.Compare(a.from, b.from)
+		})
+	}
+	n.single = single
+	if len(multi) > 0 {
+		n.multi = multi
+	}
+}
+
+// prepare runs the stages in front of the variant rules on s
+func (n *Normalizer) prepare(s string) []rune {
+	var t Text
+	return n.stage(s, &t).runes
+}
+
+// compileLeet folds both sides of the leetspeak table
+func (n *Normalizer) compileLeet() {
+	if len(n.leetTable) == 0 {
+		return
+	}
+
+	leet := make(map[rune]rune, len(n.leetTable))
+	for from, to := range n.leetTable {
+		key, value := n.fold(string(from), nil)[0], n.fold(string(to), nil)[0]
+		if key != value {
+			leet[key] = value
+		}
+	}
+	n.leet = leet
+}
+
+// compileSkeleton folds the prototypes of the confusable table, and folds them
+// once more through the table in case case folding turned them into another
+// confusable. Characters that folding already rewrites never reach the table
+// and are left out
+func (n *Normalizer) compileSkeleton() {
+	if len(n.confusables) == 0 {
+		return
+	}
+
+	folded := make(map[rune][]rune, len(n.confusables))
+	for from, to := range n.confusables {
+		if n.fold(string(from), nil)[0] == from {
+			folded[from] = n.fold(to, nil)
+		}
+	}
+	n.skeleton = folded
+	skeleton := make(map[rune][]rune, len(folded))
+	for key, to := range folded {
+		if to = n.skeletonize(to); len(to) != 1 || to[0] != key {
+			skeleton[key] = to
+		}
+	}
+	n.skeleton = skeleton
+}
+
+// skeletonize returns runes with every confusable replaced by its skeleton
+func (n *Normalizer) skeletonize(runes []rune) []rune {
+	if n.skeleton == nil {
+		return runes
+	}
+	out := make([]rune, 0, len(runes))
+	for _, r := range runes {
+		if to, ok := n.skeleton[r]; ok {
+			out = append(out, to...)
+		} else {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func (n *Normalizer) LoadVariantMap(r io.Reader) error {
+	variants, err := ParseVariantMap(r)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	n.AddVariants(variants)
+	return nil
+}
+
+func (n *Normalizer) IsVariantLoaded() bool {
+	return len(n.variants) > 0
+}
 
-	variantMap = make(map[rune]rune, 8000)
-	sc := bufio.NewScanner(f)
+// ParseVariantMap reads "variant<TAB>standard" lines. Either side may hold
+// several characters, when the standard side lists space separated candidates
+// as OpenCC tables do, the first one is used
+func ParseVariantMap(r io.Reader) (map[string]string, error) {
+	variants := make(map[string]string, 8000)
+	sc := bufio.NewScanner(r)
 	for sc.Scan() {
 		line := strings.TrimSpace(sc.Text())
 		if line == "" || line[0] == '#' {
@@ -112,15 +577,45 @@ func LoadVariantMap(path string) error {
 		if len(parts) != 2 {
 			continue
 		}
-		t := []rune(strings.TrimSpace(parts[0]))
-		s := []rune(strings.TrimSpace(parts[1]))
-		if len(t) == 1 && len(s) == 1 {
-			variantMap[t[0]] = s[0]
+		from := strings.TrimSpace(parts[0])
+		to := strings.Fields(parts[1])
+		if from != "" && len(to) > 0 {
+			variants[from] = to[0]
 		}
 	}
-	return sc.Err()
+	return variants, sc.Err()
 }
 
-func IsVariantLoaded() bool {
-	return len(variantMap) > 0
+// ParseCharTable reads "character<TAB>value" lines, such as the confusables
+// table, lines whose first field is not a single character are skipped
+func ParseCharTable(r io.Reader) (map[rune]string, error) {
+	pairs, err := ParseVariantMap(r)
+	if err != nil {
+		return nil, err
+	}
+	table := make(map[rune]string, len(pairs))
+	for from, to := range pairs {
+		if runes := []rune(from); len(runes) == 1 {
+			table[runes[0]] = to
+		}
+	}
+	return table, nil
+}
+
+func IsNoise(r rune) bool {
+	return unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.Is(unicode.Cf, r) ||
+		unicode.Is(unicode.Variation_Selector, r) || unicode.Is(unicode.So, r)
+}
+
+func StripNoise(text string, noise func(rune) bool) string {
+	stripped := strings.Map(func(r rune) rune {
+		if noise(r) {
+			return -1
+		}
+		return r
+	}, text)
+	if stripped == "" {
+		return text
+	}
+	return stripped
 }
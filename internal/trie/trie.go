@@ -3,10 +3,17 @@
 // Created: 2025-01-15
 package trie
 
-import "sort"
+import (
+	"cmp"
+	"slices"
+	"sort"
+	"unicode"
+	"unicode/utf8"
+)
 
 const (
-	initialSize = 524288
+	ringSize  = 128
+	stopEvery = 4096 // Runes walked between two calls of the stop func of Search
 )
 
 type Match struct {
@@ -14,51 +21,128 @@ type Match struct {
 	Start int
 	End   int
 	Level int
+	Alias bool // Matched through an alias rather than the word's own key
 }
 
+// Overlap, which of several matches sharing characters Search keeps
+type Overlap int
+
+const (
+	OverlapAll              Overlap = iota // Keep every match
+	OverlapLeftmostLongest                 // Keep the leftmost match, the longest of those starting there
+	OverlapLeftmostShortest                // Keep the leftmost match, the shortest of those starting there
+	OverlapHighestLevel                    // Keep the most severe match, then the longest, then the leftmost
+)
+
 type output struct {
 	word  *string
 	level int
 	len   int
+	alias bool
+}
+
+// entry, word stored under a key of a source tree
+type entry struct {
+	word  string
+	level int
+	alias bool
 }
 
 type trieNode struct {
 	children map[rune]*trieNode
 	isEnd    bool
+	alias    bool
 	word     *string
 	level    int
+	depth    int
 }
 
 type Tree struct {
 	base         []int
 	check        []int
 	fail         []int
+	reach        []int // Highest level output by a state or along its fail links
+	depth        []int // Length of the key a state stands for
 	output       []*[]output
 	children     [][]int
 	used         []bool
 	size         int
 	nextCheckPos int
-	root         *trieNode
+	maxLen       int
+	wholeWords   bool             // Noise is skipped only inside matches standing as whole words
+	keys         map[string]entry // Words of a source tree by key, a compiled tree has none
+	root         *trieNode        // Trie of the keys, only kept while Build runs
 }
 
+// New returns an empty source tree. It stores its words by key, which takes a
+// fraction of the memory of a trie, and Compile builds the automaton
 func New() *Tree {
-	return &Tree{
-		root:         &trieNode{children: make(map[rune]*trieNode, 8)},
-		nextCheckPos: 1,
+	return &Tree{keys: make(map[string]entry), nextCheckPos: 1}
+}
+
+func (t *Tree) Insert(key, word string, level int) bool {
+	current, ok := t.keys[key]
+	t.keys[key] = entry{word: word, level: level}
+	return !ok || current.alias
+}
+
+// InsertAlias adds key as another spelling of word, such as its pinyin. An
+// alias never replaces a word or an earlier alias, it reports whether key was
+// added
+func (t *Tree) InsertAlias(key, word string, level int) bool {
+	if _, ok := t.keys[key]; ok {
+		return false
+	}
+	t.keys[key] = entry{word: word, level: level, alias: true}
+	return true
+}
+
+// Lookup returns the word stored under key and its level, aliases are not
+// reported
+func (t *Tree) Lookup(key string) (string, int, bool) {
+	current, ok := t.keys[key]
+	if !ok || current.alias {
+		return "", 0, false
 	}
+	return current.word, current.level, true
 }
 
-func (t *Tree) Insert(word string, level int) {
-	current := t.root
-	for _, r := range word {
-		if _, exists := current.children[r]; !exists {
-			current.children[r] = &trieNode{children: make(map[rune]*trieNode, 4)}
+// Remove deletes key from the source tree, it reports whether key was
+// present. Aliases are left alone
+func (t *Tree) Remove(key string) bool {
+	if current, ok := t.keys[key]; !ok || current.alias {
+		return false
+	}
+	delete(t.keys, key)
+	return true
+}
+
+// RemoveAlias deletes key if it is an alias of word
+func (t *Tree) RemoveAlias(key, word string) bool {
+	if current, ok := t.keys[key]; !ok || !current.alias || current.word != word {
+		return false
+	}
+	delete(t.keys, key)
+	return true
+}
+
+// trie builds the trie of the keys for Build
+func (t *Tree) trie() *trieNode {
+	root := &trieNode{children: make(map[rune]*trieNode, 8)}
+	for key, e := range t.keys {
+		current := root
+		for _, r := range key {
+			if _, exists := current.children[r]; !exists {
+				current.children[r] = &trieNode{children: make(map[rune]*trieNode, 4), depth: current.depth + 1}
+			}
+			current = current.children[r]
 		}
-		current = current.children[r]
+		current.isEnd = true
+		current.alias = e.alias
+		current.word = &e.word
+		current.level = e.level
 	}
-	current.isEnd = true
-	current.word = &word
-	current.level = level
+	return root
 }
 
 func (t *Tree) Build() {
@@ -66,15 +150,18 @@ func (t *Tree) Build() {
 		return
 	}
 
-	t.base = make([]int, initialSize)
-	t.check = make([]int, initialSize)
-	t.fail = make([]int, initialSize)
-	t.output = make([]*[]output, initialSize)
-	t.children = make([][]int, initialSize)
-	t.used = make([]bool, initialSize)
-	t.size = 1
+	size := t.capacity()
+	t.base = make([]int, size)
+	t.check = make([]int, size)
+	t.fail = make([]int, size)
+	t.output = make([]*[]output, size)
+	t.children = make([][]int, size)
+	t.used = make([]bool, size)
 
 	t.used[0] = true
+	t.size = 1
+	t.nextCheckPos = 1
+	t.maxLen = 0
 
 	chars := make([]int, 0, len(t.root.children))
 	for r := range t.root.children {
@@ -114,28 +201,37 @@ func (t *Tree) Build() {
 		t.children[0] = append(t.children[0], c)
 
 		if child.isEnd {
-			wordLen := len([]rune(*child.word))
+			wordLen := child.depth
+			if wordLen > t.maxLen {
+				t.maxLen = wordLen
+			}
 			out := make([]output, 0, 1)
 			t.output[next] = &out
 			*t.output[next] = append(*t.output[next], output{
 				word:  child.word,
 				level: child.level,
 				len:   wordLen,
+				alias: child.alias,
 			})
 		}
 
 		if next >= t.size {
 			t.size = next + 1
 		}
-
-		t.buildDATRecursive(child, next)
+	}
+	// Descendants are placed only once every root transition holds its slot,
+	// otherwise a subtree could claim the slot of a later sibling
+	for _, c := range chars {
+		t.buildDATRecursive(t.root.children[rune(c)], c)
 	}
 
 	queue := make([]int, 0, 8192)
 	head := 0
+	t.depth = make([]int, len(t.fail))
 
 	for _, c := range t.children[0] {
 		t.fail[c] = 0
+		t.depth[c] = 1
 		queue = append(queue, c)
 	}
 
@@ -149,6 +245,7 @@ func (t *Tree) Build() {
 				continue
 			}
 			queue = append(queue, next)
+			t.depth[next] = t.depth[state] + 1
 
 			failState := t.fail[state]
 			for {
@@ -173,10 +270,95 @@ func (t *Tree) Build() {
 		}
 	}
 
-	t.root = nil
+	// Fail links point to shallower states, which the queue holds first
+	t.reach = make([]int, len(t.fail))
+	for _, state := range queue {
+		level := t.reach[t.fail[state]]
+		if t.output[state] != nil {
+			for _, out := range *t.output[state] {
+				level = max(level, out.level)
+			}
+		}
+		t.reach[state] = level
+	}
+
+	for i := range t.check {
+		if !t.used[i] {
+			t.check[i] = -1
+		}
+	}
+
 	t.children = nil
 }
 
+// capacity estimates the size of the double array: a state is placed at the
+// base of its parent plus its rune, so the arrays span about the largest rune
+// plus one slot per node. They grow during Build if that falls short
+func (t *Tree) capacity() int {
+	nodes, top := 1, 0
+	var count func(node *trieNode)
+	count = func(node *trieNode) {
+		for r, child := range node.children {
+			nodes++
+			top = max(top, int(r))
+			count(child)
+		}
+	}
+	count(t.root)
+	return top + nodes
+}
+
+// Walk calls fn for every word in the source tree in key order, aliases are
+// skipped
+func (t *Tree) Walk(fn func(word string, level int)) {
+	keys := make([]string, 0, len(t.keys))
+	for key, e := range t.keys {
+		if !e.alias {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		fn(t.keys[key].word, t.keys[key].level)
+	}
+}
+
+// Compile builds the double array of the current words into a new Tree, leaving
+// t untouched so it can keep being mutated while the result is searched
+func (t *Tree) Compile() *Tree {
+	compiled := &Tree{root: t.trie()}
+	compiled.Build()
+	compiled.root = nil
+	return compiled
+}
+
+// WholeWordNoise keeps a match that has noise skipped inside only when it
+// starts and ends on word boundaries, so "b a d" is found but "ass" is not
+// found across the space in "was seen"
+func (t *Tree) WholeWordNoise() {
+	t.wholeWords = true
+}
+
+// straddles reports whether the match text[start:end] of a key of length runes
+// has noise skipped inside while beginning or ending within a Latin word, see
+// WholeWordNoise
+func (t *Tree) straddles(text []rune, start, end, length int) bool {
+	if !t.wholeWords || end-start == length {
+		return false
+	}
+	return start > 0 && IsWordRune(text[start-1]) && IsWordRune(text[start]) ||
+		end < len(text) && IsWordRune(text[end-1]) && IsWordRune(text[end])
+}
+
+// IsWordRune reports whether r is a Latin letter or a digit, the characters
+// that run together into words
+func IsWordRune(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+	}
+	return r != utf8.RuneError && (unicode.Is(unicode.Latin, r) || unicode.IsDigit(r))
+}
+
 func (t *Tree) buildDATRecursive(node *trieNode, state int) {
 	if node == nil || len(node.children) == 0 {
 		return
@@ -246,7 +428,10 @@ func (t *Tree) buildDATRecursive(node *trieNode, state int) {
 
 		child := node.children[rune(c)]
 		if child.isEnd {
-			wordLen := len([]rune(*child.word))
+			wordLen := child.depth
+			if wordLen > t.maxLen {
+				t.maxLen = wordLen
+			}
 			if t.output[next] == nil {
 				out := make([]output, 0, 1)
 				t.output[next] = &out
@@ -255,19 +440,32 @@ func (t *Tree) buildDATRecursive(node *trieNode, state int) {
 				word:  child.word,
 				level: child.level,
 				len:   wordLen,
+				alias: child.alias,
 			})
 		}
 
 		if next >= t.size {
 			t.size = next + 1
 		}
-
-		t.buildDATRecursive(child, next)
 	}
+	for _, c := range chars {
+		t.buildDATRecursive(node.children[rune(c)], base+c)
+	}
+}
+
+func (t *Tree) SearchDAT(text []rune, skip func(rune) bool) []Match {
+	return t.Search(text, skip, OverlapAll, nil)
 }
 
-func (t *Tree) SearchDAT(text []rune) []Match {
-	matches := make([]Match, 0, 16)
+// Search returns the words in text ordered by end position. Overlapping
+// matches are resolved by overlap during the walk: they are held back only
+// until the depth of the current state shows no later match can overlap them.
+// A non-nil stop is called every few thousand runes, the walk ends early with
+// the matches found so far once it returns true
+func (t *Tree) Search(text []rune, skip func(rune) bool, overlap Overlap, stop func() bool) []Match {
+	var matches []Match
+	var pending []Match
+	pendingEnd := 0
 	state := 0
 	base := t.base
 	check := t.check
@@ -276,9 +474,16 @@ func (t *Tree) SearchDAT(text []rune) []Match {
 	baseLen := len(base)
 	checkLen := len(check)
 	outputLen := len(output)
+	var ringBuf [ringSize]int
+	ring := t.ring(ringBuf[:], skip)
+	consumed := 0
 
 	for i, r := range text {
+		if stop != nil && i > 0 && i%stopEvery == 0 && stop() {
+			break
+		}
 		c := int(r)
+		skipped := false
 		for {
 			if state >= baseLen {
 				state = 0
@@ -289,40 +494,161 @@ func (t *Tree) SearchDAT(text []rune) []Match {
 				state = next
 				break
 			}
+			if skip != nil && skip(r) {
+				skipped = true
+				break
+			}
 			if state == 0 {
 				break
 			}
 			state = fail[state]
 		}
+		if skipped {
+			continue
+		}
+		if ring != nil {
+			ring[consumed%len(ring)] = i
+		}
+		consumed++
 
+		if overlap != OverlapAll {
+			// No match ending here or later starts before the key of state
+			if len(pending) > 0 && t.nextStart(ring, consumed, state, i) >= pendingEnd {
+				matches = resolveCluster(pending, overlap, matches, trieSpan)
+				pending = pending[:0]
+			}
+		}
 		for temp := state; temp > 0; temp = fail[temp] {
 			if temp < outputLen && output[temp] != nil {
+				if matches == nil {
+					// Allocated on the first key found, clean text allocates nothing
+					matches = make([]Match, 0, 16)
+				}
 				for _, out := range *output[temp] {
-					matches = append(matches, Match{
+					m := Match{
 						Word:  *out.word,
-						Start: i - out.len + 1,
+						Start: startOf(ring, consumed, out.len, i),
 						End:   i + 1,
 						Level: out.level,
-					})
+						Alias: out.alias,
+					}
+					if t.straddles(text, m.Start, m.End, out.len) {
+						continue
+					}
+					if overlap == OverlapAll {
+						matches = append(matches, m)
+						continue
+					}
+					pending = append(pending, m)
+					pendingEnd = max(pendingEnd, m.End)
 				}
 			}
 		}
 	}
+	if len(pending) > 0 {
+		matches = resolveCluster(pending, overlap, matches, trieSpan)
+	}
 	return matches
 }
 
-func (t *Tree) Contains(text []rune) bool {
+// nextStart returns the text position of the first character of the key of
+// state, the earliest a match ending at i or later can start
+func (t *Tree) nextStart(ring []int, consumed, state, i int) int {
+	if state >= len(t.depth) || t.depth[state] == 0 {
+		return i + 1
+	}
+	return startOf(ring, consumed, t.depth[state], i)
+}
+
+func trieSpan(m Match) (int, int, int) {
+	return m.Start, m.End, m.Level
+}
+
+// Resolve keeps the matches overlap selects, like Search does during the walk,
+// for matches gathered some other way. matches are ordered by end position and
+// so is the result, span returns the characters a match covers and its level
+func Resolve[M any](matches []M, overlap Overlap, span func(M) (start, end, level int)) []M {
+	if overlap == OverlapAll || len(matches) < 2 {
+		return matches
+	}
+	sorted := slices.Clone(matches)
+	slices.SortStableFunc(sorted, func(a, b M) int {
+		aStart, _, _ := span(a)
+		bStart, _, _ := span(b)
+		return cmp.Compare(aStart, bStart)
+	})
+
+	resolved := make([]M, 0, len(matches))
+	first, clusterEnd := 0, 0
+	for i, m := range sorted {
+		start, end, _ := span(m)
+		if i > 0 && start >= clusterEnd {
+			resolved = resolveCluster(sorted[first:i], overlap, resolved, span)
+			first = i
+		}
+		clusterEnd = max(clusterEnd, end)
+	}
+	return resolveCluster(sorted[first:], overlap, resolved, span)
+}
+
+// resolveCluster appends to out the matches overlap keeps from a cluster of
+// matches that no match outside of it overlaps, ordered by position
+func resolveCluster[M any](cluster []M, overlap Overlap, out []M, span func(M) (start, end, level int)) []M {
+	if len(cluster) == 1 {
+		return append(out, cluster[0])
+	}
+	slices.SortStableFunc(cluster, func(a, b M) int {
+		aStart, aEnd, aLevel := span(a)
+		bStart, bEnd, bLevel := span(b)
+		switch overlap {
+		case OverlapLeftmostShortest:
+			return cmp.Or(cmp.Compare(aStart, bStart), cmp.Compare(aEnd, bEnd))
+		case OverlapHighestLevel:
+			return cmp.Or(cmp.Compare(bLevel, aLevel), cmp.Compare(bEnd-bStart, aEnd-aStart), cmp.Compare(aStart, bStart))
+		}
+		return cmp.Or(cmp.Compare(aStart, bStart), cmp.Compare(bEnd, aEnd))
+	})
+
+	kept := len(out)
+	for _, m := range cluster {
+		start, end, _ := span(m)
+		if !slices.ContainsFunc(out[kept:], func(k M) bool {
+			kStart, kEnd, _ := span(k)
+			return start < kEnd && kStart < end
+		}) {
+			out = append(out, m)
+		}
+	}
+	slices.SortFunc(out[kept:], func(a, b M) int {
+		aStart, _, _ := span(a)
+		bStart, _, _ := span(b)
+		return cmp.Compare(aStart, bStart)
+	})
+	return out
+}
+
+// Contains reports whether text holds a word of level min or above, min must
+// be positive. States that cannot reach such a word are passed over without
+// following their fail links
+func (t *Tree) Contains(text []rune, skip func(rune) bool, min int) bool {
+	if t.wholeWords && skip != nil {
+		// A word found across noise may still be dropped, which takes its span
+		_, ok := t.first(text, skip, min)
+		return ok
+	}
+
 	state := 0
 	base := t.base
 	check := t.check
 	fail := t.fail
-	output := t.output
+	reach := t.reach
 	baseLen := len(base)
 	checkLen := len(check)
-	outputLen := len(output)
+	reachLen := len(reach)
 
 	for _, r := range text {
 		c := int(r)
+		skipped := false
 		for {
 			if state >= baseLen {
 				state = 0
@@ -333,33 +659,52 @@ func (t *Tree) Contains(text []rune) bool {
 				state = next
 				break
 			}
+			if skip != nil && skip(r) {
+				skipped = true
+				break
+			}
 			if state == 0 {
 				break
 			}
 			state = fail[state]
 		}
+		if skipped {
+			continue
+		}
 
-		for temp := state; temp > 0; temp = fail[temp] {
-			if temp < outputLen && output[temp] != nil {
-				return true
-			}
+		if state < reachLen && reach[state] >= min {
+			return true
 		}
 	}
 	return false
 }
 
-func (t *Tree) FindFirst(text []rune) *Match {
+// FindFirst returns the first word of level min or above to end in text, the
+// longest one where several end at the same position
+func (t *Tree) FindFirst(text []rune, skip func(rune) bool, min int) *Match {
+	if m, ok := t.first(text, skip, min); ok {
+		return &m
+	}
+	return nil
+}
+
+func (t *Tree) first(text []rune, skip func(rune) bool, min int) (Match, bool) {
 	state := 0
 	base := t.base
 	check := t.check
 	fail := t.fail
+	reach := t.reach
 	output := t.output
 	baseLen := len(base)
 	checkLen := len(check)
-	outputLen := len(output)
+	reachLen := len(reach)
+	var ringBuf [ringSize]int
+	ring := t.ring(ringBuf[:], skip)
+	consumed := 0
 
 	for i, r := range text {
 		c := int(r)
+		skipped := false
 		for {
 			if state >= baseLen {
 				state = 0
@@ -370,25 +715,133 @@ func (t *Tree) FindFirst(text []rune) *Match {
 				state = next
 				break
 			}
+			if skip != nil && skip(r) {
+				skipped = true
+				break
+			}
 			if state == 0 {
 				break
 			}
 			state = fail[state]
 		}
+		if skipped {
+			continue
+		}
+		if ring != nil {
+			ring[consumed%len(ring)] = i
+		}
+		consumed++
 
+		if state >= reachLen || reach[state] < min {
+			continue
+		}
 		for temp := state; temp > 0; temp = fail[temp] {
-			if temp < outputLen && output[temp] != nil {
-				out := (*output[temp])[0]
-				return &Match{
-					Word:  *out.word,
-					Start: i - out.len + 1,
-					End:   i + 1,
-					Level: out.level,
+			if output[temp] == nil {
+				continue
+			}
+			for _, out := range *output[temp] {
+				start := startOf(ring, consumed, out.len, i)
+				if out.level >= min && !t.straddles(text, start, i+1, out.len) {
+					return Match{
+						Word:  *out.word,
+						Start: start,
+						End:   i + 1,
+						Level: out.level,
+						Alias: out.alias,
+					}, true
 				}
 			}
 		}
 	}
-	return nil
+	return Match{}, false
+}
+
+// Walker, automaton walk fed one rune at a time, for text that arrives in
+// pieces. It keeps only the current state, so it can run over text of any size
+type Walker struct {
+	tree     *Tree
+	skip     func(rune) bool
+	state    int
+	consumed int // Runes consumed so far, the skipped ones are not counted
+}
+
+func (t *Tree) NewWalker(skip func(rune) bool) *Walker {
+	return &Walker{tree: t, skip: skip}
+}
+
+// Step feeds r to the walk and appends the words ending with it to out. Match
+// positions count consumed runes, Step reports whether r was consumed or
+// skipped as noise
+func (w *Walker) Step(r rune, out []Match) ([]Match, bool) {
+	t := w.tree
+	c := int(r)
+	for {
+		if w.state >= len(t.base) {
+			w.state = 0
+			break
+		}
+		next := t.base[w.state] + c
+		if next < len(t.check) && t.check[next] == w.state {
+			w.state = next
+			break
+		}
+		if w.skip != nil && w.skip(r) {
+			return out, false
+		}
+		if w.state == 0 {
+			break
+		}
+		w.state = t.fail[w.state]
+	}
+	w.consumed++
+
+	for temp := w.state; temp > 0; temp = t.fail[temp] {
+		if temp < len(t.output) && t.output[temp] != nil {
+			for _, o := range *t.output[temp] {
+				out = append(out, Match{
+					Word:  *o.word,
+					Start: w.consumed - o.len,
+					End:   w.consumed,
+					Level: o.level,
+					Alias: o.alias,
+				})
+			}
+		}
+	}
+	return out, true
+}
+
+// Depth returns how many of the last consumed runes the current state stands
+// for, no match found later starts before them
+func (w *Walker) Depth() int {
+	if w.state >= len(w.tree.depth) {
+		return 0
+	}
+	return w.tree.depth[w.state]
+}
+
+// MaxLen returns the length in runes of the longest key
+func (t *Tree) MaxLen() int {
+	return t.maxLen
+}
+
+// ring returns a buffer holding the text positions of the last maxLen consumed
+// runes, or nil when nothing is skipped and positions are contiguous
+func (t *Tree) ring(buf []int, skip func(rune) bool) []int {
+	if skip == nil || t.maxLen == 0 {
+		return nil
+	}
+	if t.maxLen <= len(buf) {
+		return buf[:t.maxLen]
+	}
+	return make([]int, t.maxLen)
+}
+
+func startOf(ring []int, consumed, length, end int) int {
+	if ring == nil {
+		return end - length + 1
+	}
+	return ring[(consumed-length)%len(ring)]
 }
 
 func (t *Tree) Size() int {
@@ -396,5 +849,5 @@ func (t *Tree) Size() int {
 }
 
 func (t *Tree) MemoryUsage() int64 {
-	return int64(len(t.base)*8 + len(t.check)*8 + len(t.fail)*8 + len(t.used))
+	return int64(len(t.base)*8 + len(t.check)*8 + len(t.fail)*8 + len(t.reach)*8 + len(t.depth)*8 + len(t.used))
 }
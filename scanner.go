@@ -0,0 +1,326 @@
+// Package sensitive provides high-performance sensitive word detection using AC automaton
+// Creator: Done-0
+// Created: 2026-10-16
+package sensitive
+
+import (
+	"io"
+	"math"
+	"slices"
+	"unicode/utf8"
+
+	"github.com/Done-0/sensitive/internal/normalizer"
+	"github.com/Done-0/sensitive/internal/trie"
+)
+
+const (
+	chunkSize = 4096 // Bytes a Scanner normalizes at a time
+	maxEmpty  = 100  // Reads in a row returning no data and no error before a Scanner gives up, like bufio
+)
+
+// Scanner, streaming detection over an io.Reader, see Detector.NewScanner
+type Scanner struct {
+	snap       *snapshot
+	reader     io.Reader
+	overlap    trie.Overlap    // Match mode of the detector
+	buf        []byte          // Bytes read and not yet scanned
+	offset     int             // Byte offset of buf in the stream
+	runes      int             // Rune index of buf in the stream
+	fed        int             // Normalized runes fed to the walks so far
+	last       rune            // Last rune scanned, the one before buf
+	eof        bool            // Whether the reader is drained
+	text       normalizer.Text // Normalized buf
+	main       cursor          // Walk of the dictionary
+	allow      *cursor         // Walk of the allowlist, nil without one
+	pending    []Match         // Matches an allowlisted phrase or an overlap may still drop
+	pendingEnd int             // Byte offset just past the pending matches
+	ready      []Match         // Matches to report
+	next       int             // Index in ready of the next match to report
+	match      Match           // Match returned by Match
+	err        error
+}
+
+// cursor, automaton walk over the stream that remembers where its last
+// consumed runes came from, as many as the longest key
+type cursor struct {
+	walker *trie.Walker
+	spans  []runeSpan   // Spans of the last consumed runes, by consumed count
+	count  int          // Runes consumed so far
+	found  []trie.Match // Keys ending at the rune fed last
+}
+
+// runeSpan, source of a normalized rune in the stream
+type runeSpan struct {
+	index     int  // Index of the normalized rune in the stream
+	runeStart int  // Rune index of the source characters
+	runeEnd   int  // Rune index just past them
+	byteStart int  // Byte offset of the source characters
+	byteEnd   int  // Byte offset just past them
+	before    rune // Character before the source, for word boundaries
+	first     rune // First source character
+	last      rune // Last source character
+	after     rune // Character after the source
+	opens     bool // First rune the source character is spelled with
+	closes    bool // Last rune the source character is spelled with
+}
+
+// NewScanner returns a Scanner reporting the matches in the text read from r
+// while it is read. The automaton state is kept from one chunk to the next,
+// so words split between reads are found, and besides a fixed read buffer
+// only the spans of the last runes the longest word can cover are kept.
+// Matches carry absolute offsets in the stream and no Matched text, since the
+// text is not kept. Boundaries, the allowlist and the match mode apply as in
+// Detect, phonetic and split character matching do not
+func (d *Detector) NewScanner(r io.Reader) *Scanner {
+	snap := d.snapshot()
+	s := &Scanner{
+		snap:    snap,
+		reader:  r,
+		overlap: trie.Overlap(d.opts.MatchMode),
+		buf:     make([]byte, 0, 2*chunkSize),
+		main:    newCursor(snap.tree, d.skipFunc()),
+	}
+	if snap.allow != nil {
+		allow := newCursor(snap.allow, d.skipFunc())
+		s.allow = &allow
+	}
+	return s
+}
+
+// ScanReader calls fn with every match in the text read from r, see
+// NewScanner. It stops at the first error returned by fn or r
+func (d *Detector) ScanReader(r io.Reader, fn func(Match) error) error {
+	s := d.NewScanner(r)
+	for s.Scan() {
+		if err := fn(s.Match()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// Scan advances to the next match, reading as much as it takes to find it. It
+// returns false at the end of the input or on a read error, see Err
+func (s *Scanner) Scan() bool {
+	for s.next == len(s.ready) {
+		s.ready, s.next = s.ready[:0], 0
+		if s.err != nil || s.eof && len(s.buf) == 0 && len(s.pending) == 0 {
+			return false
+		}
+		s.fill()
+	}
+	s.match = s.ready[s.next]
+	s.next++
+	return true
+}
+
+// Match returns the match found by the last call to Scan
+func (s *Scanner) Match() Match {
+	return s.match
+}
+
+// Err returns the first error the reader returned other than io.EOF, or
+// io.ErrNoProgress if it kept returning no data and no error
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// fill reads a chunk and scans it, at the end of the input it also reports
+// the matches still held back. When nothing read can be scanned yet, it reads
+// on until the buffer is full
+func (s *Scanner) fill() {
+	for want := chunkSize; ; want = cap(s.buf) {
+		if !s.read(want) {
+			return
+		}
+		text := string(s.buf)
+		s.snap.normalizer.ToText(text, &s.text)
+		count, settled := s.cut(text)
+		if !settled && !s.eof && len(s.buf) < cap(s.buf) {
+			continue
+		}
+		s.scan(count)
+		s.buf = s.buf[:copy(s.buf, s.buf[s.text.Offsets[count]:])]
+		if s.eof && len(s.buf) == 0 {
+			s.flush()
+		}
+		return
+	}
+}
+
+// read reads until buf holds want bytes or the input ends, it reports false
+// on a read error
+func (s *Scanner) read(want int) bool {
+	for empty := 0; !s.eof && len(s.buf) < want; {
+		n, err := s.reader.Read(s.buf[len(s.buf):cap(s.buf)])
+		s.buf = s.buf[:len(s.buf)+n]
+		if err == io.EOF {
+			s.eof = true
+		} else if err != nil {
+			s.err = err
+			return false
+		}
+		if n > 0 || s.eof {
+			empty = 0
+		} else if empty++; empty == maxEmpty {
+			s.err = io.ErrNoProgress
+			return false
+		}
+	}
+	return true
+}
+
+// cut returns how many runes of the normalized buf to scan now: all of them
+// at the end of the input, or else the runes whose normalization the text
+// read later cannot change, so rewrite rules, combining sequences and
+// leetspeak words cut by a read are normalized whole, and the character after
+// them is known. It reports false when buf holds no such runes
+func (s *Scanner) cut(text string) (int, bool) {
+	if s.eof {
+		return len(s.text.Offsets) - 1, true
+	}
+	return s.snap.normalizer.Settled(text, &s.text)
+}
+
+// scan walks the first count runes of buf, normalized in text
+func (s *Scanner) scan(count int) {
+	if count == 0 {
+		return
+	}
+	t := &s.text
+	chunk := s.buf[:t.Offsets[count]]
+	next, _ := utf8.DecodeRune(s.buf[len(chunk):])
+	char := func(i int) rune {
+		switch {
+		case i < 0:
+			return s.last
+		case i >= count:
+			return next
+		}
+		r, _ := utf8.DecodeRune(chunk[t.Offsets[i]:])
+		return r
+	}
+
+	fed := 0
+	for i, r := range t.Runes {
+		start, end := t.Starts[i], t.Ends[i]
+		if start >= count {
+			break
+		}
+		fed++
+		span := runeSpan{
+			index:     s.fed + i,
+			runeStart: s.runes + start,
+			runeEnd:   s.runes + end,
+			byteStart: s.offset + t.Offsets[start],
+			byteEnd:   s.offset + t.Offsets[end],
+		}
+		span.before, span.first, span.last, span.after = char(start-1), char(start), char(end-1), char(end)
+		span.opens = i == 0 || t.Starts[i-1] != start
+		span.closes = i+1 == len(t.Runes) || t.Starts[i+1] != start
+
+		if s.main.step(r, span) {
+			for _, m := range s.main.found {
+				s.add(m)
+			}
+		}
+		if s.allow != nil && s.allow.step(r, span) {
+			for _, a := range s.allow.found {
+				from, to := s.allow.span(a.Start).byteStart, s.allow.span(a.End-1).byteEnd
+				s.pending = slices.DeleteFunc(s.pending, func(m Match) bool {
+					return from <= m.ByteStart && m.ByteEnd <= to
+				})
+			}
+		}
+		s.settle()
+	}
+
+	s.offset += len(chunk)
+	s.runes += count
+	s.fed += fed
+	s.last, _ = utf8.DecodeLastRune(chunk)
+}
+
+// add holds back the match m found by the dictionary walk, with the further
+// additions of its word kept by ConflictKeepAll
+func (s *Scanner) add(m trie.Match) {
+	first, last := s.main.span(m.Start), s.main.span(m.End-1)
+	if !first.opens || !last.closes {
+		return
+	}
+	opts := s.snap.wordOpts[m.Word]
+	skipped := last.index-first.index+1 != m.End-m.Start
+	if (skipped || m.Alias || opts.Boundary == BoundaryWord) && crossesWord(first.before, first.first, last.last, last.after) {
+		return
+	}
+	match := Match{
+		Word:      m.Word,
+		Start:     first.runeStart,
+		End:       last.runeEnd,
+		ByteStart: first.byteStart,
+		ByteEnd:   last.byteEnd,
+		Level:     Level(m.Level),
+		Category:  opts.Category,
+	}
+	s.pending = append(s.pending, match)
+	for _, e := range s.snap.extra[m.Word] {
+		match.Word, match.Level, match.Category = e.word, e.level, e.opts.Category
+		s.pending = append(s.pending, match)
+	}
+	s.pendingEnd = max(s.pendingEnd, last.byteEnd)
+}
+
+// settle reports the pending matches once no allowlisted phrase found later
+// can cover them and, unless every match is kept, no match found later can
+// overlap them
+func (s *Scanner) settle() {
+	if len(s.pending) == 0 {
+		return
+	}
+	if s.overlap != trie.OverlapAll && s.main.nextStart() < s.pendingEnd {
+		return
+	}
+	if s.allow != nil && s.allow.nextStart() < s.pendingEnd {
+		return
+	}
+	s.flush()
+}
+
+func (s *Scanner) flush() {
+	s.ready = append(s.ready, trie.Resolve(s.pending, s.overlap, matchSpan)...)
+	s.pending, s.pendingEnd = s.pending[:0], 0
+}
+
+func newCursor(tree *trie.Tree, skip func(rune) bool) cursor {
+	return cursor{
+		walker: tree.NewWalker(skip),
+		spans:  make([]runeSpan, max(tree.MaxLen(), 1)),
+	}
+}
+
+// step feeds r, which comes from span, to the walk and reports whether it was
+// consumed, the keys it ends are then in found
+func (c *cursor) step(r rune, span runeSpan) bool {
+	var consumed bool
+	c.found, consumed = c.walker.Step(r, c.found[:0])
+	if consumed {
+		c.spans[c.count%len(c.spans)] = span
+		c.count++
+	}
+	return consumed
+}
+
+// span returns the span of the i-th consumed rune, one of the last ones
+func (c *cursor) span(i int) runeSpan {
+	return c.spans[i%len(c.spans)]
+}
+
+// nextStart returns the byte offset a key found from now on starts at or
+// after, past everything fed so far when the walk stands at the root
+func (c *cursor) nextStart() int {
+	depth := c.walker.Depth()
+	if depth == 0 {
+		return math.MaxInt
+	}
+	return c.span(c.count - depth).byteStart
+}
@@ -3,6 +3,18 @@
 // Created: 2025-01-15
 package sensitive
 
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Level, severity of a word. Levels are ordered by value, a greater level is
+// more severe, and custom levels are added with RegisterLevel
 type Level int
 
 const (
@@ -11,28 +23,183 @@ const (
 	LevelHigh   Level = 3
 )
 
+// levelNames holds the name of every registered level
+var levelNames = struct {
+	sync.RWMutex
+	names map[Level]string // Level name, such as "High"
+}{names: map[Level]string{LevelLow: "Low", LevelMedium: "Medium", LevelHigh: "High"}}
+
+// RegisterLevel adds a custom level, such as RegisterLevel(4, "Critical") or
+// RegisterLevel(100, "BlockAccount"). Its name can be used as a dictionary
+// file prefix ("critical_words.txt") and in level= attributes, ignoring case.
+// Registering a level again under the same name is a no-op, reusing a level
+// value or a name is an error
+func RegisterLevel(level Level, name string) error {
+	if level < 1 {
+		return errors.New("level must be positive")
+	}
+	if name == "" || strings.ContainsFunc(name, func(r rune) bool { return unicode.IsSpace(r) || r == '_' }) {
+		return errors.New("invalid level name")
+	}
+
+	levelNames.Lock()
+	defer levelNames.Unlock()
+
+	if current, ok := levelNames.names[level]; ok {
+		if current == name {
+			return nil
+		}
+		return errors.New("level already registered as " + current)
+	}
+	for _, current := range levelNames.names {
+		if strings.EqualFold(current, name) {
+			return errors.New("level name already registered")
+		}
+	}
+	levelNames.names[level] = name
+	return nil
+}
+
+// Levels returns every registered level from the least to the most severe
+func Levels() []Level {
+	levelNames.RLock()
+	defer levelNames.RUnlock()
+	return slices.Sorted(maps.Keys(levelNames.names))
+}
+
+// ParseLevel returns the registered level called name, ignoring case, or
+// written as its number
+func ParseLevel(name string) (Level, bool) {
+	levelNames.RLock()
+	defer levelNames.RUnlock()
+
+	if n, err := strconv.Atoi(name); err == nil {
+		_, ok := levelNames.names[Level(n)]
+		return Level(n), ok
+	}
+	for level, current := range levelNames.names {
+		if strings.EqualFold(current, name) {
+			return level, true
+		}
+	}
+	return 0, false
+}
+
 func (l Level) String() string {
-	switch l {
-	case LevelLow:
-		return "Low"
-	case LevelMedium:
-		return "Medium"
-	case LevelHigh:
-		return "High"
-	default:
-		return "Unknown"
+	levelNames.RLock()
+	defer levelNames.RUnlock()
+
+	if name, ok := levelNames.names[l]; ok {
+		return name
 	}
+	return "Unknown"
 }
 
+// IsValid reports whether l is predefined or registered
 func (l Level) IsValid() bool {
-	return l >= LevelLow && l <= LevelHigh
+	levelNames.RLock()
+	defer levelNames.RUnlock()
+
+	_, ok := levelNames.names[l]
+	return ok
+}
+
+// Boundary controls where in the text a word may match
+type Boundary int
+
+const (
+	BoundaryNone Boundary = iota // Match anywhere, as a substring
+	BoundaryWord                 // Latin letters and digits at either end must not run on into the text
+)
+
+// WordOptions, optional attributes of a dictionary word
+type WordOptions struct {
+	Boundary Boundary // Where the word may match, "sex" with BoundaryWord matches "sex!" but not "Essex"
+	Category string   // Category reported on Match, such as CategoryAd, dictionaries default to their file name
+	Replace  string   // Text written over the word in FilteredText instead of the filter strategy
+}
+
+// ConflictPolicy decides which addition of a word is kept when the word is
+// added again with a different level or options, such as by two dictionaries
+type ConflictPolicy int
+
+const (
+	ConflictLastWins  ConflictPolicy = iota // The later addition replaces the word
+	ConflictFirstWins                       // The earlier addition is kept
+	ConflictMaxLevel                        // The more severe addition is kept, the earlier one on a tie
+	ConflictKeepAll                         // Both are kept, each one is reported as its own match
+)
+
+// WordSource, one addition of a word
+type WordSource struct {
+	Word    string      // Word as added
+	Source  string      // Dictionary path, URL or embedded name, empty for AddWord
+	Level   Level       // Level of the addition
+	Options WordOptions // Attributes of the addition
+}
+
+// Conflict, word added again with a different level or options and how the
+// detector's ConflictPolicy resolved it
+type Conflict struct {
+	Winner WordSource // Addition in effect
+	Loser  WordSource // Addition overridden by Winner, still reported with ConflictKeepAll
+}
+
+// MatchMode, which of several matches sharing characters are reported
+type MatchMode int
+
+const (
+	MatchAll              MatchMode = iota // Every match, "出售炸药" yields both "出售炸药" and "炸药"
+	MatchLeftmostLongest                   // The leftmost match, the longest of those starting there
+	MatchLeftmostShortest                  // The leftmost match, the shortest of those starting there, whatever order words were added in
+	MatchHighestLevel                      // The most severe match, then the longest, then the leftmost
+)
+
+// SourceKind, where a DictSource is read from
+type SourceKind int
+
+const (
+	SourceFile     SourceKind = iota // Dictionary file at a path
+	SourceEmbedded                   // Built-in dictionary, such as DictHighPolitics
+	SourceURL                        // Dictionary fetched over HTTP
+)
+
+// DictSource, dictionary loaded as part of a LoadPlan
+type DictSource struct {
+	Name     string      // File path, embedded dictionary name or URL
+	Kind     SourceKind  // How Name is read
+	Level    Level       // Level of the words, zero infers it from Name like LoadDict
+	Options  WordOptions // Attributes of the words, see LoadDictWithOptions
+	Priority int         // Sources load from the lowest priority to the highest
+}
+
+// LoadPlan, dictionaries loaded by Detector.Load in order of priority. Sources
+// of equal priority load in plan order, so the same plan always resolves
+// duplicated words the same way: with the default ConflictLastWins the
+// source with the highest priority wins
+type LoadPlan []DictSource
+
+// LoadReport, outcome of a Detector.Load
+type LoadReport struct {
+	Sources    []string    // Name of every source in the order it was loaded
+	Duplicates []Duplicate // Words added by several sources, in the order they were first duplicated
+}
+
+// Duplicate, word added by several sources with different levels or options
+type Duplicate struct {
+	Winner WordSource   // Addition in effect
+	Losers []WordSource // Other additions, still reported with ConflictKeepAll
 }
 
 type Match struct {
-	Word  string
-	Start int
-	End   int
-	Level Level
+	Word      string // Dictionary word that matched
+	Start     int    // Rune index of the first matched character in the input
+	End       int    // Rune index just past the last matched character
+	ByteStart int    // Byte offset of the match in the input
+	ByteEnd   int    // Byte offset just past the match in the input
+	Matched   string // Input substring covered by the match, input[ByteStart:ByteEnd]
+	Level     Level
+	Category  string // Category of the word, see WordOptions
 }
 
 type Result struct {
@@ -41,6 +208,32 @@ type Result struct {
 	FilteredText string
 }
 
+// ParseError, invalid line in a dictionary file
+type ParseError struct {
+	Source string // Path or URL of the dictionary, empty if unknown
+	Line   int    // Line number, starting at 1
+	Msg    string // What is wrong with the line
+}
+
+func (e *ParseError) Error() string {
+	line := strconv.Itoa(e.Line)
+	if e.Source == "" {
+		return "line " + line + ": " + e.Msg
+	}
+	return e.Source + ":" + line + ": " + e.Msg
+}
+
+// InputTooLargeError, text refused by DetectContext for being longer than
+// WithMaxInputSize
+type InputTooLargeError struct {
+	Size  int // Length of the text in bytes
+	Limit int // Longest text accepted, in bytes
+}
+
+func (e *InputTooLargeError) Error() string {
+	return "input of " + strconv.Itoa(e.Size) + " bytes exceeds the limit of " + strconv.Itoa(e.Limit) + " bytes"
+}
+
 type Stats struct {
 	TotalWords int
 	TreeDepth  int
@@ -55,12 +248,67 @@ const (
 	StrategyReplace
 )
 
+// DetectOption, per call setting of DetectWithOptions
+type DetectOption func(*detectOptions)
+
+// detectOptions, settings of a single DetectWithOptions call
+type detectOptions struct {
+	categories map[string]bool // Categories to report or, with exclude, to leave out
+	exclude    bool            // Report every category except categories
+	minLevel   Level           // Matches below it are reported but not filtered
+}
+
+// keep reports whether m is selected by o
+func (o *detectOptions) keep(m Match) bool {
+	return o.categories == nil || o.categories[m.Category] != o.exclude
+}
+
+// Categories only reports and filters matches of the given categories
+func Categories(categories ...string) DetectOption {
+	return func(o *detectOptions) { o.setCategories(categories, false) }
+}
+
+// ExcludeCategories reports and filters every match except those of the
+// given categories
+func ExcludeCategories(categories ...string) DetectOption {
+	return func(o *detectOptions) { o.setCategories(categories, true) }
+}
+
+// MinLevel only filters matches of level or above, lower matches are still
+// reported in Result.Matches but left in FilteredText and do not set
+// HasSensitive. It overrides the detector's WithMinLevel
+func MinLevel(level Level) DetectOption {
+	return func(o *detectOptions) { o.minLevel = level }
+}
+
+func (o *detectOptions) setCategories(categories []string, exclude bool) {
+	o.categories = make(map[string]bool, len(categories))
+	for _, c := range categories {
+		o.categories[c] = true
+	}
+	o.exclude = exclude
+}
+
 type Options struct {
-	FilterStrategy FilterStrategy
-	ReplaceChar    rune
-	SkipWhitespace bool
-	EnableVariant  bool
-	CaseSensitive  bool
+	FilterStrategy     FilterStrategy
+	CategoryStrategies map[string]FilterStrategy // Filter strategy per category, overriding FilterStrategy
+	ReplaceChar        rune
+	SkipWhitespace     bool
+	SkipFunc           func(rune) bool
+	EnableVariant      bool
+	CaseSensitive      bool
+	ConfusableFolding  bool
+	NFKC               bool
+	Pinyin             bool
+	PinyinInitials     bool // Also index pinyin initials, see WithPinyinInitials
+	Phonetic           bool
+	SplitCharacters    bool
+	LeetTable          map[rune]rune
+	LeetASCIIOnly      bool
+	MinLevel           Level // Matches below it are reported but not filtered, see WithMinLevel
+	ConflictPolicy     ConflictPolicy
+	MatchMode          MatchMode
+	MaxInputSize       int // Longest text DetectContext accepts in bytes, zero for no limit
 }
 
 type Option func(*Options)
@@ -69,6 +317,48 @@ func WithFilterStrategy(s FilterStrategy) Option {
 	return func(o *Options) { o.FilterStrategy = s }
 }
 
+// WithCategoryStrategy filters the matches of category with strategy instead
+// of the detector's filter strategy, such as StrategyRemove for CategoryURL
+func WithCategoryStrategy(category string, strategy FilterStrategy) Option {
+	return func(o *Options) { o.CategoryStrategies = categoryStrategies(o.CategoryStrategies, category, strategy) }
+}
+
+// categoryStrategies returns a copy of strategies with category set, so
+// options shared with other detectors are left alone
+func categoryStrategies(strategies map[string]FilterStrategy, category string, strategy FilterStrategy) map[string]FilterStrategy {
+	clone := make(map[string]FilterStrategy, len(strategies)+1)
+	maps.Copy(clone, strategies)
+	clone[category] = strategy
+	return clone
+}
+
+// WithMinLevel sets the level a match needs to be filtered, to count for
+// HasSensitive, Contains and Validate and to be returned by FindFirst, such
+// as LevelMedium to let Low words through while still reporting them
+func WithMinLevel(level Level) Option {
+	return func(o *Options) { o.MinLevel = level }
+}
+
+// WithConflictPolicy sets how a word added again with a different level or
+// options is resolved (default ConflictLastWins), every conflict is listed
+// by Detector.Conflicts
+func WithConflictPolicy(policy ConflictPolicy) Option {
+	return func(o *Options) { o.ConflictPolicy = policy }
+}
+
+// WithMatchMode sets which overlapping matches Detect, FindAll and FindFirst
+// report (default MatchAll). The other modes report no two matches sharing a
+// character, resolved while the automaton walks the text
+func WithMatchMode(mode MatchMode) Option {
+	return func(o *Options) { o.MatchMode = mode }
+}
+
+// WithMaxInputSize makes DetectContext refuse text longer than size bytes
+// with an *InputTooLargeError, zero accepts any length
+func WithMaxInputSize(size int) Option {
+	return func(o *Options) { o.MaxInputSize = size }
+}
+
 func WithReplaceChar(c rune) Option {
 	return func(o *Options) { o.ReplaceChar = c }
 }
@@ -77,6 +367,10 @@ func WithSkipWhitespace(skip bool) Option {
 	return func(o *Options) { o.SkipWhitespace = skip }
 }
 
+func WithSkipFunc(fn func(rune) bool) Option {
+	return func(o *Options) { o.SkipFunc = fn }
+}
+
 func WithVariant(enable bool) Option {
 	return func(o *Options) { o.EnableVariant = enable }
 }
@@ -84,3 +378,71 @@ func WithVariant(enable bool) Option {
 func WithCaseSensitive(sensitive bool) Option {
 	return func(o *Options) { o.CaseSensitive = sensitive }
 }
+
+func WithConfusableFolding(enable bool) Option {
+	return func(o *Options) { o.ConfusableFolding = enable }
+}
+
+// WithNFKC applies NFKC normalization to dictionary words and input text and
+// strips invisible characters and stray combining marks, so "ﬁ", "①" or
+// "b\u200bad" fold to plain text
+func WithNFKC(enable bool) Option {
+	return func(o *Options) { o.NFKC = enable }
+}
+
+// WithPinyin also indexes Hanzi words under their full pinyin, "习近平"
+// matches "xijinping" with Match.Word still "习近平"
+func WithPinyin(enable bool) Option {
+	return func(o *Options) { o.Pinyin = enable }
+}
+
+// WithPinyinInitials also indexes words of three Hanzi or more under their
+// pinyin initials when WithPinyin is on, "习近平" matches "xjp". Initials
+// often spell ordinary words, "偷荤二奶" gives "then", so they are off by
+// default
+func WithPinyinInitials(enable bool) Option {
+	return func(o *Options) { o.PinyinInitials = enable }
+}
+
+// WithPhonetic matches Hanzi words by pronunciation, any character may be
+// written as itself, its pinyin or a homophone: "习jin平" and "席近平" match
+// "习近平". Such matches must contain at least one Hanzi, pure pinyin is left
+// to WithPinyin
+func WithPhonetic(enable bool) Option {
+	return func(o *Options) { o.Phonetic = enable }
+}
+
+// WithSplitCharacters matches Hanzi written as their left and right
+// components, "弓虽女干" matches "强奸" and "氵去" matches "法". The match spans
+// the component characters
+func WithSplitCharacters(enable bool) Option {
+	return func(o *Options) { o.SplitCharacters = enable }
+}
+
+// WithLeetFolding folds leetspeak such as "b4d" or "$pam" in both dictionary
+// words and input text. A nil table uses DefaultLeetTable, an empty one turns
+// leet folding off
+func WithLeetFolding(table map[rune]rune) Option {
+	return func(o *Options) { o.LeetTable = leetTable(table) }
+}
+
+// WithLeetASCIIOnly restricts leet folding to ASCII words, so digits in CJK
+// text and plain numbers are left alone (default true)
+func WithLeetASCIIOnly(only bool) Option {
+	return func(o *Options) { o.LeetASCIIOnly = only }
+}
+
+// DefaultLeetTable returns a copy of the built-in leetspeak table
+func DefaultLeetTable() map[rune]rune {
+	return map[rune]rune{
+		'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b', '9': 'g',
+		'@': 'a', '$': 's', '!': 'i', '+': 't', '|': 'l',
+	}
+}
+
+func leetTable(table map[rune]rune) map[rune]rune {
+	if table == nil {
+		return DefaultLeetTable()
+	}
+	return table
+}